@@ -0,0 +1,69 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"debugged-dev/kip/v1/pkg/project"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fatih/color"
+)
+
+// filterAffectedServices only keeps the services with changes since the git ref
+func filterAffectedServices(out io.Writer, services []project.ServiceProject, ref string) []project.ServiceProject {
+	affected, err := project.AffectedServices(kipProject, ref)
+	if err != nil {
+		fmt.Fprintln(out, color.RedString("unable to determine changes since \"%s\": %v", ref, err))
+		os.Exit(1)
+	}
+
+	filtered := []project.ServiceProject{}
+
+	for _, service := range services {
+		for _, affectedService := range affected {
+			if service.Name() == affectedService.Name() {
+				filtered = append(filtered, service)
+				break
+			}
+		}
+	}
+
+	return filtered
+}
+
+// filterAffectedCharts only keeps the charts with changes since the git ref
+func filterAffectedCharts(out io.Writer, charts []project.Chart, ref string) []project.Chart {
+	affected, err := project.AffectedCharts(kipProject, ref)
+	if err != nil {
+		fmt.Fprintln(out, color.RedString("unable to determine changes since \"%s\": %v", ref, err))
+		os.Exit(1)
+	}
+
+	filtered := []project.Chart{}
+
+	for _, chart := range charts {
+		for _, affectedChart := range affected {
+			if chart.Path() == affectedChart.Path() {
+				filtered = append(filtered, chart)
+				break
+			}
+		}
+	}
+
+	return filtered
+}
@@ -18,6 +18,7 @@ package main
 import (
 	"io"
 	"os"
+	"strconv"
 
 	"github.com/spf13/cobra"
 )
@@ -30,6 +31,10 @@ type bpOptions struct {
 	key         string
 	debug       bool
 	parallel    int
+	force       bool
+	since       string
+	failFast    bool
+	output      string
 }
 
 func newBuildPushCmd(out io.Writer) *cobra.Command {
@@ -48,10 +53,14 @@ func newBuildPushCmd(out io.Writer) *cobra.Command {
 			buildArgs := os.Args[2:]
 
 			buildCmd := newBuildCmd(out)
+			buildCmd.FParseErrWhitelist.UnknownFlags = true
 			buildCmd.ParseFlags(buildArgs)
+			// set explicitly so every spelling of the flag accepted by this command reaches the build
+			buildCmd.Flags().Set("force", strconv.FormatBool(o.force))
 			buildCmd.Run(cmd, buildArgs)
 
 			pushCmd := newPushCmd(out)
+			pushCmd.FParseErrWhitelist.UnknownFlags = true
 			pushCmd.ParseFlags(buildArgs)
 			pushCmd.Run(cmd, buildArgs)
 		},
@@ -66,6 +75,10 @@ func newBuildPushCmd(out io.Writer) *cobra.Command {
 	f.StringArrayVarP(&o.services, "service", "s", []string{}, "services to build")
 	f.BoolVarP(&o.debug, "debug", "d", false, "debug output")
 	f.IntVarP(&o.parallel, "parallel", "p", 4, "number of builds to run parallel")
+	f.BoolVarP(&o.force, "force", "f", false, "build even if the image for the build context already exists")
+	f.StringVar(&o.since, "since", "", "only handle services with changes since git ref")
+	f.BoolVar(&o.failFast, "fail-fast", false, "cancel queued builds and pushes after the first failure")
+	f.StringVarP(&o.output, "output", "o", "", "output: tty, plain or json events (default plain when stdout is not a terminal)")
 
 	registerServiceAutocomplete(cmd)
 
@@ -18,6 +18,7 @@ package main
 import (
 	"io"
 	"os"
+	"strconv"
 
 	"github.com/spf13/cobra"
 )
@@ -31,6 +32,10 @@ type bpdOptions struct {
 	debug       bool
 	parallel    int
 	force       bool
+	forceBuild  bool
+	since       string
+	failFast    bool
+	output      string
 }
 
 func newBuildPushDeployCmd(out io.Writer) *cobra.Command {
@@ -49,15 +54,21 @@ func newBuildPushDeployCmd(out io.Writer) *cobra.Command {
 			buildArgs := os.Args[2:]
 
 			buildCmd := newBuildCmd(out)
+			buildCmd.FParseErrWhitelist.UnknownFlags = true
 			buildCmd.ParseFlags(buildArgs)
+			// set explicitly, -f of this command only forces the deploy while the build would parse it as its own
+			buildCmd.Flags().Set("force", strconv.FormatBool(o.forceBuild))
 			buildCmd.Run(cmd, buildArgs)
 
 			pushCmd := newPushCmd(out)
+			pushCmd.FParseErrWhitelist.UnknownFlags = true
 			pushCmd.ParseFlags(buildArgs)
 			pushCmd.Run(cmd, buildArgs)
 
 			deployCmd := newDeployCmd(out)
+			deployCmd.FParseErrWhitelist.UnknownFlags = true
 			deployCmd.ParseFlags(buildArgs)
+			deployCmd.Flags().Set("force", strconv.FormatBool(o.force))
 			deployCmd.Run(cmd, buildArgs)
 		},
 	}
@@ -71,7 +82,11 @@ func newBuildPushDeployCmd(out io.Writer) *cobra.Command {
 	f.StringArrayVarP(&o.services, "service", "s", []string{}, "services to build")
 	f.BoolVarP(&o.debug, "debug", "d", false, "debug output")
 	f.IntVarP(&o.parallel, "parallel", "p", 4, "number of builds to run parallel")
-	f.BoolVarP(&o.force, "force", "f", false, "force deploy")
+	f.BoolVarP(&o.force, "force", "f", false, "deploy even if the charts are unchanged")
+	f.BoolVar(&o.forceBuild, "force-build", false, "build even if the image for the build context already exists")
+	f.StringVar(&o.since, "since", "", "only handle charts and services with changes since git ref")
+	f.BoolVar(&o.failFast, "fail-fast", false, "cancel queued builds and pushes after the first failure")
+	f.StringVarP(&o.output, "output", "o", "", "output: tty, plain or json events (default plain when stdout is not a terminal)")
 
 	registerServiceAutocomplete(cmd)
 
@@ -16,18 +16,17 @@ limitations under the License.
 package main
 
 import (
-	"debugged-dev/kip/v1/internal/project"
+	"debugged-dev/kip/v1/pkg/project"
 	"fmt"
 	"io"
 	"log"
 	"os"
-	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/fatih/color"
 	"github.com/gammazero/workerpool"
-	"github.com/schollz/progressbar/v3"
 	"github.com/spf13/cobra"
 	"robpike.io/filter"
 )
@@ -40,6 +39,10 @@ type buildOptions struct {
 	key         string
 	debug       bool
 	parallel    int
+	force       bool
+	since       string
+	failFast    bool
+	output      string
 }
 
 func newBuildCmd(out io.Writer) *cobra.Command {
@@ -55,13 +58,15 @@ func newBuildCmd(out io.Writer) *cobra.Command {
 	This application is a tool to generate the needed files
 	to quickly create a Cobra application.`,
 		Run: func(cmd *cobra.Command, args []string) {
+			out := setupOutput(out, o.output)
+
 			if !hasKipConfig {
 				log.Fatalln("run this command inside a kip project")
 			}
 
 			extraArgs := cmd.Flags().Args()
 
-			services := kipProject.Services()
+			services := projectServices(out, kipProject)
 			servicesToBuild := []project.ServiceProject{}
 
 			if kipProject.Template() == "service" {
@@ -69,9 +74,13 @@ func newBuildCmd(out io.Writer) *cobra.Command {
 				o.all = true
 			}
 
+			if o.since != "" && len(o.services) == 0 {
+				o.all = true
+			}
+
 			if !o.all && len(o.services) == 0 {
 				fmt.Fprint(out, "specify what to build using -s required or use -a to build all services\n")
-				os.Exit(1)
+				exit(1)
 			}
 
 			if o.environment == "" {
@@ -107,43 +116,43 @@ func newBuildCmd(out io.Writer) *cobra.Command {
 						servicesToBuild = append(servicesToBuild, foundService.(project.ServiceProject))
 					} else {
 						fmt.Fprintf(out, "service \"%s\" does not exist in project\n", serviceName)
-						os.Exit(1)
+						exit(1)
 					}
 				}
 			}
 
+			if o.since != "" {
+				servicesToBuild = filterAffectedServices(out, servicesToBuild, o.since)
+
+				if len(servicesToBuild) == 0 {
+					fmt.Fprintf(out, "no services changed since \"%s\"\n", o.since)
+					return
+				}
+			}
+
+			servicesToBuild = withDependencies(out, servicesToBuild, services)
+
 			serviceNames := filter.Apply(servicesToBuild, func(s project.ServiceProject) string {
 				return s.Name()
 			}).([]string)
 
 			fmt.Fprintf(out, "Building services: %s\n", strings.Join(serviceNames, ","))
 
-			preBuildscripts := kipProject.GetScripts("pre-build", o.environment)
-
-			if len(preBuildscripts) > 0 {
-				for _, script := range preBuildscripts {
-					fmt.Fprintf(out, color.BlueString("RUN script: \"%s\"\n"), script.Name)
-
-					err := script.Run(out, []string{})
-					if err != nil {
-						log.Fatalf("error running script \"%s\": %v", script.Name, err)
-					}
-				}
+			if err := runScripts(out, "pre-build", o.environment); err != nil {
+				fmt.Fprintln(out, color.RedString("%v", err))
+				exit(1)
 			}
 
-			buildServices(out, servicesToBuild, o.repository, o.key, extraArgs, o.environment, o.parallel, o.debug)
+			results := buildServices(out, servicesToBuild, o.repository, o.key, extraArgs, o.environment, o.parallel, o.debug, o.force, o.failFast, o.output)
+			renderResults(out, "BUILD", results)
 
-			postBuildscripts := kipProject.GetScripts("post-build", o.environment)
-
-			if len(postBuildscripts) > 0 {
-				for _, script := range postBuildscripts {
-					fmt.Fprintf(out, color.BlueString("RUN script: \"%s\"\n"), script.Name)
+			if hasFailures(results) {
+				exit(1)
+			}
 
-					err := script.Run(out, []string{})
-					if err != nil {
-						log.Fatalf("error running script \"%s\": %v", script.Name, err)
-					}
-				}
+			if err := runScripts(out, "post-build", o.environment); err != nil {
+				fmt.Fprintln(out, color.RedString("%v", err))
+				exit(1)
 			}
 		},
 	}
@@ -156,12 +165,26 @@ func newBuildCmd(out io.Writer) *cobra.Command {
 	f.StringArrayVarP(&o.services, "service", "s", []string{}, "services to build")
 	f.BoolVarP(&o.debug, "debug", "d", false, "debug output")
 	f.IntVarP(&o.parallel, "parallel", "p", 4, "number of builds to run parallel")
+	f.BoolVarP(&o.force, "force", "f", false, "build even if the image for the build context already exists")
+	f.StringVar(&o.since, "since", "", "only build services with changes since git ref")
+	f.BoolVar(&o.failFast, "fail-fast", false, "cancel queued builds after the first failure")
+	f.StringVarP(&o.output, "output", "o", "", "output: tty, plain or json events (default plain when stdout is not a terminal)")
 
 	registerServiceAutocomplete(cmd)
 
 	return cmd
 }
 
+// withDependencies adds the services the selected services depend on, their images have to exist before
+// the selected services build FROM them
+func withDependencies(out io.Writer, selected []project.ServiceProject, services []project.ServiceProject) []project.ServiceProject {
+	selected, added := project.WithDependencies(selected, services)
+	if len(added) > 0 {
+		fmt.Fprintf(out, "Adding dependencies: %s\n", strings.Join(added, ","))
+	}
+	return selected
+}
+
 func removeStringFromArray(s []string, r string) []string {
 	for i, v := range s {
 		if v == r {
@@ -171,82 +194,195 @@ func removeStringFromArray(s []string, r string) []string {
 	return s
 }
 
-func buildServices(out io.Writer, services []project.ServiceProject, repository string, key string, args []string, environment string, parallel int, debug bool) {
+func buildServices(out io.Writer, services []project.ServiceProject, repository string, key string, args []string, environment string, parallel int, debug bool, force bool, failFast bool, output string) []serviceResult {
+	services, err := project.SortServices(services)
+	if err != nil {
+		fmt.Fprintln(out, color.RedString("%v", err))
+		exit(1)
+	}
+
+	total := 0
+	for _, service := range services {
+		if service.HasDockerfile(environment) {
+			total++
+		}
+	}
+
+	progress, err := newProgressReporter(out, "BUILD", total, output)
+	if err != nil {
+		fmt.Fprintln(out, color.RedString("%v", err))
+		exit(1)
+	}
+
 	wp := workerpool.New(parallel)
 
 	os.Setenv("DOCKER_BUILDKIT", "1")
 
-	bar := progressbar.NewOptions(-1,
-		progressbar.OptionSetWriter(out),
-		progressbar.OptionSpinnerType(14),
-		progressbar.OptionClearOnFinish(),
-		progressbar.OptionUseANSICodes(true),
-	)
-
-	finished := 0
-	building := []string{}
-	total := 0
 	start := time.Now()
+	results := &serviceResults{stage: stageBuild, environment: environment}
 
-	go func() {
-		for !bar.IsFinished() {
-			bar.RenderBlank()
-			time.Sleep(time.Millisecond * 100)
-		}
-	}()
+	events.emit(event{Stage: stageBuild, Event: eventStarted, Environment: environment})
+
+	// services are only submitted to the pool when all services they depend on are built
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	selected := map[string]bool{}
+	failed := map[string]bool{}
+	cancelled := false
+	waiting := map[string]int{}
+	dependents := map[string][]project.ServiceProject{}
 
 	for _, service := range services {
-		service := service
-		if service.HasDockerfile() {
-			total++
-			wp.Submit(func() {
-				serviceStart := time.Now()
-				building = append(building, service.Name())
-				sort.Strings(building)
+		selected[service.Name()] = true
+	}
+
+	for _, service := range services {
+		for _, dependency := range service.DependsOn() {
+			if selected[dependency] {
+				waiting[service.Name()]++
+				dependents[dependency] = append(dependents[dependency], service)
+			}
+		}
+	}
 
-				bar.Describe(fmt.Sprintf("%v/%v Building (%v)", finished, total, strings.Join(building, ", ")))
+	var submit func(service project.ServiceProject)
 
-				defer func() {
-					finished++
-					building = removeStringFromArray(building, service.Name())
-					bar.Describe(fmt.Sprintf("%v/%v Building (%v)", finished, total, strings.Join(building, ", ")))
-				}()
+	done := func(service project.ServiceProject, success bool) {
+		ready := []project.ServiceProject{}
 
-				extraArgs := append(args, service.DockerBuildArgs(environment)...)
+		mu.Lock()
+		if !success {
+			failed[service.Name()] = true
+			cancelled = cancelled || failFast
+		}
+		for _, dependent := range dependents[service.Name()] {
+			waiting[dependent.Name()]--
+			if waiting[dependent.Name()] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+		mu.Unlock()
 
-				if debug {
-					bar.Clear()
-					fmt.Fprintf(out, color.BlueString("BUILDING %s with args: %s\n"), service.Name(), color.YellowString("%s", strings.Join(extraArgs, ", ")))
-				}
+		for _, dependent := range ready {
+			submit(dependent)
+		}
 
-				output, buildErr := service.Build(repository, key, extraArgs, environment)
-				d := time.Since(serviceStart)
-				d = d.Round(time.Millisecond)
+		wg.Done()
+	}
 
-				if buildErr == nil {
-					bar.Clear()
-					fmt.Fprintf(out, color.BlueString("BUILD %s %s %s\n"), service.Name(), color.GreenString("SUCCESS"), color.YellowString("%s", d))
-					if debug {
-						bar.Clear()
-						fmt.Fprintf(out, "%v\n", string(output))
-					}
-				} else {
-					bar.Clear()
-					fmt.Fprintf(out, color.BlueString("BUILD %s %s %s\n"), service.Name(), color.RedString("FAILED"), color.YellowString("%s", d))
-					bar.Clear()
-					fmt.Fprintf(out, "%v\n", string(output))
+	isCancelled := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return cancelled
+	}
+
+	submit = func(service project.ServiceProject) {
+		if !service.HasDockerfile(environment) {
+			progress.Println(fmt.Sprintf(color.BlueString("SKIP service: \"%s\" no Dockerfile"), service.Name()))
+			results.add(serviceResult{service: service.Name(), status: statusSkipped, message: "no Dockerfile"})
+			done(service, true)
+			return
+		}
+
+		mu.Lock()
+		failedDependencies := []string{}
+		for _, dependency := range service.DependsOn() {
+			if failed[dependency] {
+				failedDependencies = append(failedDependencies, dependency)
+			}
+		}
+		mu.Unlock()
+
+		if len(failedDependencies) > 0 {
+			progress.Println(fmt.Sprintf(color.BlueString("BUILD %s %s %s"), service.Name(), color.RedString("SKIPPED"), color.YellowString("dependency failed: %s", strings.Join(failedDependencies, ", "))))
+			results.add(serviceResult{service: service.Name(), status: statusSkipped, message: "dependency failed: " + strings.Join(failedDependencies, ", ")})
+			done(service, false)
+			return
+		}
+
+		wp.Submit(func() {
+			success := false
+			defer func() {
+				done(service, success)
+			}()
+
+			// --fail-fast cancels everything that did not start yet
+			if isCancelled() {
+				results.add(serviceResult{service: service.Name(), status: statusCancelled})
+				return
+			}
+
+			serviceStart := time.Now()
+			progress.Start(service.Name())
+			defer progress.Done(service.Name())
+
+			extraArgs := append(args, service.DockerBuildArgs(environment)...)
+
+			if debug {
+				progress.Println(fmt.Sprintf(color.BlueString("BUILDING %s with args: %s"), service.Name(), color.YellowString("%s", strings.Join(extraArgs, ", "))))
+			}
+
+			// with --debug the build output is streamed while the build runs, otherwise it is printed on failure
+			var buildOut io.Writer
+			var stream *prefixWriter
+			if debug {
+				stream = &prefixWriter{mu: &sync.Mutex{}, out: progressWriter{progress}, prefix: color.CyanString("%s | ", service.Name())}
+				buildOut = stream
+			}
+
+			buildOutput, skipped, buildErr := service.BuildOutput(buildOut, repository, key, extraArgs, environment, force)
+			if stream != nil {
+				stream.Flush()
+			}
+			d := time.Since(serviceStart)
+			d = d.Round(time.Millisecond)
+			success = buildErr == nil
+
+			result := serviceResult{service: service.Name(), status: statusSuccess, duration: d}
+
+			if buildErr == nil {
+				if image, err := service.Image(repository, key, environment); err == nil {
+					result.image = image.Reference()
+					result.imageID = image.ImageID
+				}
+			}
+
+			if buildErr == nil && skipped {
+				result.status = statusUnchanged
+				progress.Println(fmt.Sprintf(color.BlueString("BUILD %s %s %s"), service.Name(), color.GreenString("UNCHANGED"), color.YellowString("%s", d)))
+			} else if buildErr == nil {
+				progress.Println(fmt.Sprintf(color.BlueString("BUILD %s %s %s"), service.Name(), color.GreenString("SUCCESS"), color.YellowString("%s", d)))
+			} else {
+				result.status = statusFailed
+				result.message = buildErr.Error()
+				progress.Println(fmt.Sprintf(color.BlueString("BUILD %s %s %s"), service.Name(), color.RedString("FAILED"), color.YellowString("%s", d)))
+				if len(buildOutput) > 0 {
+					progress.Println(string(buildOutput))
 				}
-			})
-		} else {
-			bar.Clear()
-			fmt.Fprintf(out, color.BlueString("SKIP service: \"%s\" no Dockerfile\n"), service.Name())
+			}
+
+			results.add(result)
+		})
+	}
+
+	wg.Add(len(services))
+
+	for _, service := range services {
+		if waiting[service.Name()] == 0 {
+			submit(service)
 		}
 	}
 
+	wg.Wait()
 	wp.StopWait()
+	progress.Stop()
 	d := time.Since(start)
 	d = d.Round(time.Millisecond)
-	bar.Finish()
 
 	fmt.Fprintf(out, color.GreenString("BUILD %s\n"), color.YellowString("%s", d))
+
+	list := results.list()
+	events.emit(event{Stage: stageBuild, Event: eventFinished, Environment: environment, Status: stageStatus(list), Duration: d.Seconds()})
+
+	return list
 }
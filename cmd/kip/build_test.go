@@ -0,0 +1,129 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"debugged-dev/kip/v1/pkg/project"
+)
+
+var servicesWithDependencies = map[string]string{
+	"kip_config.yaml":                 "template: project\nenvironment: dev\nversion: v0.0.0\nenvironments:\n  dev:\n    repository: registry.local/\n",
+	"services/base/kip_config.yaml":   "template: service\nversion: v0.0.0\n",
+	"services/base/Dockerfile":        "FROM scratch\n",
+	"services/api/kip_config.yaml":    "template: service\nversion: v0.0.0\ndependsOn: [base]\n",
+	"services/api/Dockerfile":         "FROM registry.local/base:latest\n",
+	"services/worker/kip_config.yaml": "template: service\nversion: v0.0.0\ndependsOn: [api]\n",
+	"services/worker/Dockerfile":      "FROM registry.local/api:latest\n",
+	"services/web/kip_config.yaml":    "template: service\nversion: v0.0.0\n",
+	"services/web/Dockerfile":         "FROM scratch\n",
+}
+
+// selectedServices returns the services of the kip project with the names
+func selectedServices(t *testing.T, names ...string) []project.ServiceProject {
+	services, err := kipProject.Services()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	selected := []project.ServiceProject{}
+	for _, name := range names {
+		for _, service := range services {
+			if service.Name() == name {
+				selected = append(selected, service)
+			}
+		}
+	}
+	return selected
+}
+
+func resultStatuses(results []serviceResult) map[string]string {
+	statuses := map[string]string{}
+	for _, result := range results {
+		statuses[result.service] = result.status
+	}
+	return statuses
+}
+
+func TestWithDependencies(t *testing.T) {
+	defer useTestProject(t, servicesWithDependencies)()
+
+	var out bytes.Buffer
+	services := withDependencies(&out, selectedServices(t, "worker"), selectedServices(t, "api", "base", "web", "worker"))
+
+	names := []string{}
+	for _, service := range services {
+		names = append(names, service.Name())
+	}
+
+	if strings.Join(names, ",") != "worker,api,base" {
+		t.Errorf("expected the dependencies of worker to be built with it, got %v", names)
+	}
+
+	if out.String() != "Adding dependencies: api,base\n" {
+		t.Errorf("expected the added dependencies to be printed, got %q", out.String())
+	}
+
+	out.Reset()
+	withDependencies(&out, selectedServices(t, "web"), selectedServices(t, "api", "base", "web", "worker"))
+
+	if out.Len() > 0 {
+		t.Errorf("expected nothing to be added for web, got %q", out.String())
+	}
+}
+
+func TestBuildServicesSkipsDependentsOfFailedBuilds(t *testing.T) {
+	runner := &project.FakeRunner{}
+	defer useTestProjectWithRunner(t, servicesWithDependencies, runner)()
+
+	// every image is up to date except base, which fails to build
+	runner.On("docker inspect --format {{.Id}}", "sha256:3f1c2a9b0d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8\n", nil)
+	runner.On("docker inspect --format {{.Id}} registry.local/base:kip-", "", errors.New("no such image"))
+	runner.On("docker build "+filepath.Join(kipProject.Paths().Root, "services", "base"), "", errors.New("exit status 1"))
+
+	services := selectedServices(t, "worker", "api", "base", "web")
+	results := buildServices(ioutil.Discard, services, "", "latest", []string{}, "dev", 1, false, false, false, "plain")
+
+	expected := map[string]string{"base": statusFailed, "api": statusSkipped, "worker": statusSkipped, "web": statusUnchanged}
+	statuses := resultStatuses(results)
+
+	for service, status := range expected {
+		if statuses[service] != status {
+			t.Errorf("expected %s to be %s, got %v", service, status, statuses)
+		}
+	}
+
+	for _, result := range results {
+		if result.service == "api" && result.message != "dependency failed: base" {
+			t.Errorf("expected api to name the failed dependency, got %q", result.message)
+		}
+		if result.service == "worker" && result.message != "dependency failed: api" {
+			t.Errorf("expected worker to name the skipped dependency, got %q", result.message)
+		}
+	}
+
+	for _, call := range runner.Calls() {
+		if call.Name == "docker" && len(call.Args) > 0 && call.Args[0] == "build" && !strings.HasSuffix(call.Args[1], filepath.Join("services", "base")) {
+			t.Errorf("expected only base to be built, got %s", call)
+		}
+	}
+}
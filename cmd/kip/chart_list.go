@@ -16,7 +16,7 @@ limitations under the License.
 package main
 
 import (
-	"debugged-dev/kip/v1/internal/project"
+	"debugged-dev/kip/v1/pkg/project"
 	"fmt"
 	"io"
 	"os"
@@ -26,7 +26,20 @@ import (
 	"github.com/spf13/cobra"
 )
 
+type listChartOptions struct {
+	output string
+}
+
+type chartInfo struct {
+	Name    string `json:"name" yaml:"name"`
+	Path    string `json:"path" yaml:"path"`
+	Owner   string `json:"owner" yaml:"owner"`
+	Service string `json:"service,omitempty" yaml:"service,omitempty"`
+}
+
 func newListChartCmd(out io.Writer) *cobra.Command {
+	o := &listChartOptions{}
+
 	cmd := &cobra.Command{
 		Use:   "list",
 		Short: "lists all charts",
@@ -42,40 +55,75 @@ func newListChartCmd(out io.Writer) *cobra.Command {
 				os.Exit(1)
 			}
 
+			if err := validateListFormat(o.output); err != nil {
+				fmt.Fprintln(out, color.RedString("%v", err))
+				os.Exit(1)
+			}
+
+			if o.output == formatTable {
+				switch kipProject.Template() {
+				case "project":
+					fmt.Fprintf(out, "Charts in project %s\n", kipProject.Name())
+					renderChartsTable(out, chartInfos(projectCharts(out, kipProject), "project", ""))
+
+					for _, service := range projectServices(out, kipProject) {
+						fmt.Fprintf(out, "\nCharts in service: %s\n", service.Name())
+						renderChartsTable(out, chartInfos(projectCharts(out, service), "service", service.Name()))
+					}
+				case "service":
+					fmt.Fprintf(out, "Charts in service: %s\n", kipProject.Name())
+					renderChartsTable(out, chartInfos(projectCharts(out, kipProject), "service", kipProject.Name()))
+				}
+				return
+			}
+
+			charts := []chartInfo{}
+
 			switch kipProject.Template() {
 			case "project":
-				fmt.Printf("Charts in project %s\n", kipProject.Name())
-				renderChartsTable(kipProject.Charts())
+				charts = append(charts, chartInfos(projectCharts(out, kipProject), "project", "")...)
 
-				for _, service := range kipProject.Services() {
-					fmt.Printf("\nCharts in service: %s\n", service.Name())
-					renderChartsTable(service.Charts())
+				for _, service := range projectServices(out, kipProject) {
+					charts = append(charts, chartInfos(projectCharts(out, service), "service", service.Name())...)
 				}
-
-				break;
 			case "service":
-				fmt.Printf("Charts in service: %s\n", kipProject.Name())
-				renderChartsTable(kipProject.Charts())
-				break;
+				charts = append(charts, chartInfos(projectCharts(out, kipProject), "service", kipProject.Name())...)
+			}
+
+			names := []string{}
+			for _, chart := range charts {
+				names = append(names, chart.Name)
+			}
+
+			if err := writeList(out, o.output, charts, names); err != nil {
+				fmt.Fprintln(out, color.RedString("%v", err))
+				os.Exit(1)
 			}
 		},
 	}
 
+	f := cmd.Flags()
+	f.StringVarP(&o.output, "output", "o", formatTable, "output format: table, json, yaml or name")
+
 	return cmd
 }
 
-func renderChartsTable(charts []project.Chart) {
-	data := [][]string{}
+func chartInfos(charts []project.Chart, owner string, service string) []chartInfo {
+	infos := []chartInfo{}
 
 	for _, chart := range charts {
-		data = append(data, []string{chart.Name(), chart.Path()})
+		infos = append(infos, chartInfo{Name: chart.Name(), Path: chart.Path(), Owner: owner, Service: service})
 	}
 
-	table := tablewriter.NewWriter(color.Output)
+	return infos
+}
+
+func renderChartsTable(out io.Writer, charts []chartInfo) {
+	table := tablewriter.NewWriter(out)
 	table.SetHeader([]string{"charts", "info"})
 
-	for _, v := range data {
-		table.Append(v)
+	for _, chart := range charts {
+		table.Append([]string{chart.Name, chart.Path})
 	}
 
 	table.Render()
@@ -16,10 +16,13 @@ limitations under the License.
 package main
 
 import (
+	"debugged-dev/kip/v1/pkg/project"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"sort"
+	"strings"
 
 	"github.com/fatih/color"
 	"github.com/kyokomi/emoji"
@@ -41,16 +44,58 @@ var dependencies = []command{
 		name: "helm",
 		info: "https://helm.sh",
 	},
-	{
-		name: "docker",
-		info: "https://www.docker.com",
-	},
+}
+
+var builderInfo = map[string]string{
+	project.BuilderDocker:  "https://www.docker.com",
+	project.BuilderBuildah: "https://buildah.io",
+	project.BuilderPodman:  "https://podman.io",
+	project.BuilderKaniko:  "https://github.com/GoogleContainerTools/kaniko",
+}
+
+// builderDependencies returns the binaries of the builders the services use, docker outside of a project
+func builderDependencies() []command {
+	builders := map[string]bool{}
+
+	if hasKipConfig {
+		services, _ := kipProject.Services()
+		for _, service := range services {
+			environments := append(service.Environments(), kipProject.Environment())
+			for _, environment := range environments {
+				builder := service.BuilderName(environment)
+				// the docker api backend does not need the docker binary
+				if builder == project.BuilderDocker && service.DockerBackend() == project.DockerBackendAPI {
+					continue
+				}
+				builders[builder] = true
+			}
+		}
+	} else {
+		builders[project.BuilderDocker] = true
+	}
+
+	names := []string{}
+	for builder := range builders {
+		names = append(names, builder)
+	}
+	sort.Strings(names)
+
+	commands := []command{}
+	for _, builder := range names {
+		info, ok := builderInfo[builder]
+		if !ok {
+			info = fmt.Sprintf("builder \"%s\" is not supported, use one of %s", builder, strings.Join(project.Builders, ", "))
+		}
+		commands = append(commands, command{name: project.BuilderCommand(builder), info: info})
+	}
+
+	return commands
 }
 
 func newCheckCmd(out io.Writer) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "check",
-		Short: "checks if all dependencies are in available in $PATH",
+		Short: "checks if all dependencies and the selected image builders are in available in $PATH",
 		Long: `A longer description that spans multiple lines and likely contains examples
 	and usage of using your command. For example:
 	
@@ -61,7 +106,7 @@ func newCheckCmd(out io.Writer) *cobra.Command {
 			hasError := false
 			data := [][]string{}
 
-			for _, command := range dependencies {
+			for _, command := range append(dependencies, builderDependencies()...) {
 				path, err := exec.LookPath(command.name)
 
 				if err != nil {
@@ -17,13 +17,14 @@ package main
 
 import (
 	"bufio"
-	"debugged-dev/kip/v1/internal/project"
+	"debugged-dev/kip/v1/pkg/project"
 	"fmt"
 	"io"
-	"log"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
@@ -38,6 +39,10 @@ type deployOptions struct {
 	environment string
 	repository  string
 	key         string
+	since       string
+	diff        bool
+	diffOnly    bool
+	output      string
 }
 
 func newDeployCmd(out io.Writer) *cobra.Command {
@@ -53,222 +58,350 @@ func newDeployCmd(out io.Writer) *cobra.Command {
 	This application is a tool to generate the needed files
 	to quickly create a Cobra application.`,
 		Run: func(cmd *cobra.Command, args []string) {
-			if !hasKipConfig {
-				fmt.Fprintln(out, color.RedString("run this command inside a kip project"))
-				os.Exit(1)
-			}
+			o.run(out, cmd.Flags().Args())
+		},
+	}
 
-			extraArgs := cmd.Flags().Args()
+	f := cmd.Flags()
+	f.BoolVarP(&o.all, "all", "a", false, "deploy all charts")
+	f.StringVarP(&o.environment, "environment", "e", "", "define build enviroment")
+	f.StringVarP(&o.repository, "repository", "r", "", "repository to tag image with")
+	f.StringVarP(&o.key, "key", "k", "latest", "key to tag latest image with")
+	f.StringArrayVarP(&o.charts, "chart", "c", []string{}, "charts to deploy")
+	f.StringArrayVarP(&o.services, "service", "s", []string{}, "services to deploy")
+	f.BoolVarP(&o.force, "force", "f", false, "force deploy")
+	f.StringVar(&o.since, "since", "", "only deploy charts and services with changes since git ref")
+	f.BoolVar(&o.diff, "diff", false, "show the changes of every chart before deploying it")
+	f.StringVarP(&o.output, "output", "o", "", "output: json writes one event per line to stdout")
 
-			charts := kipProject.Charts()
-			services := kipProject.Services()
-			chartsToDeploy := []project.Chart{}
-			servicesToDeploy := []project.ServiceProject{}
+	registerServiceAutocomplete(cmd)
+	registerChartAutocomplete(cmd)
 
-			if kipProject.Template() == "service" && len(o.charts) == 0 {
-				o.all = true
-				o.services = []string{}
-			}
+	return cmd
+}
 
-			if !o.all && len(o.charts) == 0 && len(o.services) == 0 {
-				fmt.Fprint(out, "specify what to deploy using -c or -s required or use --all | -a to deploy all charts and services\n")
-				os.Exit(1)
-			}
+func (o *deployOptions) run(out io.Writer, extraArgs []string) {
+	out = setupOutput(out, o.output)
 
-			if o.all && len(o.charts) > 0 {
-				o.all = false
-			}
+	if !hasKipConfig {
+		fmt.Fprintln(out, color.RedString("run this command inside a kip project"))
+		exit(1)
+	}
 
-			if o.environment == "" {
-				o.environment = kipProject.Environment()
-			}
+	charts := projectCharts(out, kipProject)
+	services := projectServices(out, kipProject)
+	chartsToDeploy := []project.Chart{}
+	servicesToDeploy := []project.ServiceProject{}
 
-			if o.repository == "" {
-				o.repository, _ = kipProject.Repository(o.environment)
-			}
+	if kipProject.Template() == "service" && len(o.charts) == 0 {
+		o.all = true
+		o.services = []string{}
+	}
 
-			if o.all && len(o.services) > 0 {
-				fmt.Fprintf(out, "WARN: --all is ignored when --service is used\n")
-				o.all = false
-			}
+	if o.since != "" && len(o.charts) == 0 && len(o.services) == 0 {
+		o.all = true
+	}
 
-			if o.all {
-				chartsToDeploy = append(chartsToDeploy, charts...)
-				servicesToDeploy = append(servicesToDeploy, services...)
-			} else {
-				if len(o.charts) > 0 {
-
-					for _, chartName := range o.charts {
-						var foundChart *project.Chart = nil
-						for _, chart := range charts {
-							if chart.Name() == chartName {
-								foundChart = &chart
-								break
-							}
-						}
-
-						if foundChart != nil {
-							chartsToDeploy = append(chartsToDeploy, *foundChart)
-						} else {
-							fmt.Fprintf(out, "chart \"%s\" does not exist in project\n", chartName)
-							os.Exit(1)
-						}
+	if !o.all && len(o.charts) == 0 && len(o.services) == 0 {
+		fmt.Fprint(out, "specify what to deploy using -c or -s required or use --all | -a to deploy all charts and services\n")
+		exit(1)
+	}
+
+	if o.all && len(o.charts) > 0 {
+		o.all = false
+	}
+
+	if o.environment == "" {
+		o.environment = kipProject.Environment()
+	}
+
+	if o.repository == "" {
+		o.repository, _ = kipProject.Repository(o.environment)
+	}
+
+	if o.all && len(o.services) > 0 {
+		fmt.Fprintf(out, "WARN: --all is ignored when --service is used\n")
+		o.all = false
+	}
+
+	if o.all {
+		chartsToDeploy = append(chartsToDeploy, charts...)
+		servicesToDeploy = append(servicesToDeploy, services...)
+	} else {
+		if len(o.charts) > 0 {
+
+			for _, chartName := range o.charts {
+				var foundChart *project.Chart = nil
+				for _, chart := range charts {
+					if chart.Name() == chartName {
+						foundChart = &chart
+						break
 					}
 				}
 
-				if len(o.services) > 0 {
-					for _, serviceName := range o.services {
-						var foundService project.ServiceProject = project.ServiceProject{}
-						for _, service := range services {
-							if service.Name() == serviceName {
-								foundService = service
-								break
-							}
-						}
-
-						if foundService != (project.ServiceProject{}) {
-							servicesToDeploy = append(servicesToDeploy, foundService)
-						} else {
-							fmt.Fprintf(out, "service \"%s\" does not exist in project\n", serviceName)
-							os.Exit(1)
-						}
-					}
+				if foundChart != nil {
+					chartsToDeploy = append(chartsToDeploy, *foundChart)
+				} else {
+					fmt.Fprintf(out, "chart \"%s\" does not exist in project\n", chartName)
+					exit(1)
 				}
 			}
+		}
 
-			err := checkAndConfirmContext(out)
-			if err != nil {
-				fmt.Fprint(out, err)
-				os.Exit(1)
+		if len(o.services) > 0 {
+			for _, serviceName := range o.services {
+				var foundService project.ServiceProject = project.ServiceProject{}
+				for _, service := range services {
+					if service.Name() == serviceName {
+						foundService = service
+						break
+					}
+				}
+
+				if foundService != (project.ServiceProject{}) {
+					servicesToDeploy = append(servicesToDeploy, foundService)
+				} else {
+					fmt.Fprintf(out, "service \"%s\" does not exist in project\n", serviceName)
+					exit(1)
+				}
 			}
+		}
+	}
 
-			preDeployscripts := kipProject.GetScripts("pre-deploy", o.environment)
+	if o.since != "" {
+		chartsToDeploy = filterAffectedCharts(out, chartsToDeploy, o.since)
+		servicesToDeploy = filterAffectedServices(out, servicesToDeploy, o.since)
 
-			if len(preDeployscripts) > 0 {
-				for _, script := range preDeployscripts {
-					fmt.Fprintf(out, color.BlueString("RUN script: \"%s\"\n"), script.Name)
+		if len(chartsToDeploy) == 0 && len(servicesToDeploy) == 0 {
+			fmt.Fprintf(out, "no charts or services changed since \"%s\"\n", o.since)
+			return
+		}
+	}
 
-					err := script.Run(out, []string{})
-					if err != nil {
-						log.Fatalf("error running script \"%s\": %v", script.Name, err)
-					}
-				}
+	if !o.diffOnly {
+		charts := append([]project.Chart{}, chartsToDeploy...)
+		if kipProject.Template() == "project" {
+			for _, service := range servicesToDeploy {
+				charts = append(charts, projectCharts(out, service)...)
 			}
+		}
 
-			chartNames := filter.Apply(chartsToDeploy, func(c project.Chart) string {
-				return c.Name()
-			}).([]string)
-
-			serviceNames := filter.Apply(servicesToDeploy, func(s project.ServiceProject) string {
-				return s.Name()
-			}).([]string)
+		err := checkAndConfirmContext(out, o.environment, charts)
+		if err != nil {
+			fmt.Fprint(out, err)
+			exit(1)
+		}
+	}
 
-			imageArgs := []string{}
+	if !o.diffOnly {
+		if err := runScripts(out, "pre-deploy", o.environment); err != nil {
+			fmt.Fprintln(out, color.RedString("%v", err))
+			exit(1)
+		}
+	}
 
-			for _, service := range services {
-				if service.HasDockerfile() {
-					var tag string = "latest"
+	chartNames := filter.Apply(chartsToDeploy, func(c project.Chart) string {
+		return c.Name()
+	}).([]string)
 
-					if o.key != "" {
-						tag = "temp-" + o.key
-					}
+	serviceNames := filter.Apply(servicesToDeploy, func(s project.ServiceProject) string {
+		return s.Name()
+	}).([]string)
 
-					repo, _ := service.Repository(o.environment)
-					buildID, err := service.GetImageID(tag, repo)
+	images := []project.ServiceImage{}
 
-					if err == nil {
-						serviceKey := strings.ReplaceAll(service.Name(), "-", "_")
+	for _, service := range services {
+		if service.HasDockerfile(o.environment) {
+			image, err := service.Image("", o.key, o.environment)
 
-						imageArgs = append(imageArgs, []string{"--set", "global.services." + serviceKey + ".name=" + service.Name()}...)
-						imageArgs = append(imageArgs, []string{"--set", "global.services." + serviceKey + ".tag=" + buildID}...)
-					}
-				} else {
-					fmt.Fprintf(out, color.BlueString("SKIP service: %s no Dockerfile\n"), service.Name())
+			if err == nil {
+				if image.Digest == "" {
+					fmt.Fprintf(out, "WARN: no registry digest for service: %s, run kip push first to deploy by digest\n", service.Name())
 				}
+				images = append(images, image)
 			}
+		} else {
+			fmt.Fprintf(out, color.BlueString("SKIP service: %s no Dockerfile\n"), service.Name())
+		}
+	}
 
-			extraArgs = append(extraArgs, imageArgs...)
+	valuesFile, err := ioutil.TempFile("", "kip-images-*.yaml")
+	if err != nil {
+		fmt.Fprintln(out, err)
+		exit(1)
+	}
+	valuesFile.Close()
+	removeOnExit(valuesFile.Name())
 
-			if len(chartNames) > 0 {
-				fmt.Fprintf(out, "Deploying charts  : %s\n", strings.Join(chartNames, ","))
-			}
+	err = project.WriteImageValues(valuesFile.Name(), kipProject.ImageValuesPath(), images)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		exit(1)
+	}
 
-			if kipProject.Template() == "project" && len(serviceNames) > 0 {
-				fmt.Fprintf(out, "Deploying services: %s\n\n", strings.Join(serviceNames, ","))
-			}
+	extraArgs = append(extraArgs, "-f", valuesFile.Name())
 
-			deployCharts(out, chartsToDeploy, o.environment, extraArgs, o.force)
+	if o.diffOnly {
+		diffCharts(out, chartsToDeploy, o.environment, extraArgs)
 
-			if kipProject.Template() == "project" {
-				deployServices(out, servicesToDeploy, o.environment, extraArgs, o.force)
+		if kipProject.Template() == "project" {
+			for _, service := range servicesToDeploy {
+				diffCharts(out, projectCharts(out, service), o.environment, extraArgs)
 			}
+		}
 
-			postDeployscripts := kipProject.GetScripts("post-deploy", o.environment)
+		return
+	}
 
-			if len(postDeployscripts) > 0 {
-				for _, script := range postDeployscripts {
-					fmt.Fprintf(out, color.BlueString("RUN script: \"%s\"\n"), script.Name)
+	if len(chartNames) > 0 {
+		fmt.Fprintf(out, "Deploying charts  : %s\n", strings.Join(chartNames, ","))
+	}
 
-					err := script.Run(out, []string{})
-					if err != nil {
-						log.Fatalf("error running script %s: %v", script.Name, err)
-					}
-				}
-			}
-		},
+	if kipProject.Template() == "project" && len(serviceNames) > 0 {
+		fmt.Fprintf(out, "Deploying services: %s\n\n", strings.Join(serviceNames, ","))
 	}
 
-	f := cmd.Flags()
-	f.BoolVarP(&o.all, "all", "a", false, "deploy all charts")
-	f.StringVarP(&o.environment, "environment", "e", "", "define build enviroment")
-	f.StringVarP(&o.repository, "repository", "r", "", "repository to tag image with")
-	f.StringVarP(&o.key, "key", "k", "latest", "key to tag latest image with")
-	f.StringArrayVarP(&o.charts, "chart", "c", []string{}, "charts to deploy")
-	f.StringArrayVarP(&o.services, "service", "s", []string{}, "services to deploy")
-	f.BoolVarP(&o.force, "force", "f", false, "force deploy")
+	if !deployStage(out, chartsToDeploy, servicesToDeploy, o.environment, extraArgs, o.force, o.diff) {
+		exit(1)
+	}
 
-	registerServiceAutocomplete(cmd)
-	registerChartAutocomplete(cmd)
+	if err := runScripts(out, "post-deploy", o.environment); err != nil {
+		fmt.Fprintln(out, color.RedString("%v", err))
+		exit(1)
+	}
+}
 
-	return cmd
+// deployStage deploys the charts and the charts of the services between the started and finished event of
+// the deploy stage, it returns false when a chart failed
+func deployStage(out io.Writer, charts []project.Chart, services []project.ServiceProject, environment string, args []string, force bool, diff bool) bool {
+	start := time.Now()
+	events.emit(event{Stage: stageDeploy, Event: eventStarted, Environment: environment})
+
+	results, ok := deployCharts(out, charts, "", environment, args, force, diff)
+
+	if ok && kipProject.Template() == "project" {
+		var serviceResults []serviceResult
+		serviceResults, ok = deployServices(out, services, environment, args, force, diff)
+		results = append(results, serviceResults...)
+	}
+
+	events.emit(event{Stage: stageDeploy, Event: eventFinished, Environment: environment, Status: stageStatus(results), Duration: time.Since(start).Seconds()})
+
+	return ok
 }
 
-func deployCharts(out io.Writer, charts []project.Chart, environment string, args []string, force bool) {
+// deployCharts deploys the charts one after another and stops at the first failure, the results decide the
+// status of the deploy stage
+func deployCharts(out io.Writer, charts []project.Chart, serviceName string, environment string, args []string, force bool, diff bool) ([]serviceResult, bool) {
+	results := []serviceResult{}
+
 	for _, chart := range charts {
+		start := time.Now()
+		events.emit(event{Stage: stageDeploy, Event: eventStarted, Environment: environment, Service: serviceName, Chart: chart.Name()})
+
+		finished := event{Stage: stageDeploy, Event: eventFinished, Environment: environment, Service: serviceName, Chart: chart.Name(), Status: statusSuccess}
+
 		isChanged, err := chart.IsChanged(environment, args)
 		if err != nil {
+			finished.Status = statusFailed
+			finished.Error = err.Error()
+			events.emit(finished)
 			fmt.Fprint(out, err)
-			os.Exit(1)
+			return append(results, serviceResult{service: chart.Name(), status: statusFailed, message: err.Error()}), false
 		}
 
 		fmt.Fprintf(out, color.BlueString("DEPLOY chart: %s: %s \n"), chart.Name(), color.YellowString(environment))
 
 		if !isChanged && !force {
 			fmt.Fprintf(out, color.BlueString("DEPLOY chart: %s %s\n\n"), chart.Name(), color.YellowString("no changes"))
+			finished.Status = statusUnchanged
 		} else {
-			buildErr := chart.Deploy(environment, args)
+			if diff {
+				printChartDiff(out, chart, environment, args)
+			}
+
+			buildErr := chart.Deploy(out, environment, args)
 			if buildErr == nil {
 				fmt.Fprintf(out, color.BlueString("DEPLOY chart: %s %s\n\n"), chart.Name(), color.GreenString("SUCCESS"))
 			} else {
+				finished.Status = statusFailed
+				finished.Error = buildErr.Error()
+				finished.Duration = time.Since(start).Seconds()
+				events.emit(finished)
 				fmt.Fprint(out, buildErr)
-				os.Exit(1)
+				return append(results, serviceResult{service: chart.Name(), status: statusFailed, duration: time.Since(start), message: buildErr.Error()}), false
 			}
 		}
+
+		finished.Duration = time.Since(start).Seconds()
+		events.emit(finished)
+		results = append(results, serviceResult{service: chart.Name(), status: finished.Status, duration: time.Since(start)})
 	}
+
+	return results, true
 }
 
-func deployServices(out io.Writer, services []project.ServiceProject, environment string, args []string, force bool) {
+func deployServices(out io.Writer, services []project.ServiceProject, environment string, args []string, force bool, diff bool) ([]serviceResult, bool) {
+	results := []serviceResult{}
+
 	for _, service := range services {
-		charts := service.Charts()
+		charts := projectCharts(out, service)
 
 		if len(charts) > 0 {
 			fmt.Fprintf(out, color.BlueString("DEPLOY service: %s\n"), service.Name())
-			deployCharts(out, charts, environment, args, force)
+			chartResults, ok := deployCharts(out, charts, service.Name(), environment, args, force, diff)
+			results = append(results, chartResults...)
+			if !ok {
+				return results, false
+			}
 			fmt.Fprintf(out, color.BlueString("DEPLOY service: %s %s\n\n"), service.Name(), color.GreenString("SUCCESS"))
 		} else {
 			fmt.Fprintf(out, color.BlueString("SKIP DEPLOY service: \"%s\" no charts\n"), service.Name())
 		}
 	}
+
+	return results, true
+}
+
+func diffCharts(out io.Writer, charts []project.Chart, environment string, args []string) {
+	for _, chart := range charts {
+		fmt.Fprintf(out, color.BlueString("DIFF chart: %s: %s\n"), chart.Name(), color.YellowString(environment))
+		printChartDiff(out, chart, environment, args)
+	}
+}
+
+func printChartDiff(out io.Writer, chart project.Chart, environment string, args []string) {
+	diffs, err := chart.Diff(environment, args)
+	if err != nil {
+		fmt.Fprint(out, err)
+		exit(1)
+	}
+
+	if len(diffs) == 0 {
+		fmt.Fprintf(out, color.BlueString("DIFF chart: %s %s\n\n"), chart.Name(), color.YellowString("no changes"))
+		return
+	}
+
+	for _, diff := range diffs {
+		fmt.Fprintf(out, "%s\n", color.CyanString(diff.Resource))
+
+		for _, line := range strings.Split(strings.TrimSuffix(diff.Diff, "\n"), "\n") {
+			switch {
+			case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+				fmt.Fprintln(out, line)
+			case strings.HasPrefix(line, "@@"):
+				fmt.Fprintln(out, color.CyanString(line))
+			case strings.HasPrefix(line, "+"):
+				fmt.Fprintln(out, color.GreenString(line))
+			case strings.HasPrefix(line, "-"):
+				fmt.Fprintln(out, color.RedString(line))
+			default:
+				fmt.Fprintln(out, line)
+			}
+		}
+
+		fmt.Fprintln(out)
+	}
 }
 
 func currentContext() (string, error) {
@@ -283,31 +416,87 @@ func currentContext() (string, error) {
 	return context, nil
 }
 
-func checkAndConfirmContext(out io.Writer) error {
-	currentCtx, err := currentContext()
+func kubeContexts() ([]string, error) {
+	cmd := exec.Command("kubectl", "config", "get-contexts", "-o", "name")
+	output, err := cmd.Output()
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return strings.Fields(string(output)), nil
+}
 
-	foundCtx := false
+// checkAndConfirmContext checks the contexts the charts are deployed to. Contexts declared by the project
+// or a service have to exist and be whitelisted, the current context has to be whitelisted or confirmed
+func checkAndConfirmContext(out io.Writer, environment string, charts []project.Chart) error {
+	owners := map[string]string{}
+	declared := []string{}
+	usesCurrent := false
 
-	for _, ctx := range kipProject.WhitelistedContexts() {
-		if currentCtx == ctx {
-			foundCtx = true
-			break
+	targets := []project.Project{kipProject}
+	for _, chart := range charts {
+		targets = append(targets, chart.Project)
+	}
+
+	for _, target := range targets {
+		ctx := target.KubeContext(environment)
+		if ctx == "" {
+			usesCurrent = true
+			continue
+		}
+
+		if _, ok := owners[ctx]; !ok {
+			owners[ctx] = target.Name()
+			declared = append(declared, ctx)
 		}
 	}
 
-	if !foundCtx {
+	// kubectl and helm are called with the declared contexts, they have to exist and be whitelisted
+	if len(declared) > 0 {
+		contexts, err := kubeContexts()
+		if err != nil {
+			return err
+		}
+
+		whitelist := kipProject.WhitelistedContexts()
+
+		for _, ctx := range declared {
+			if !containsString(contexts, ctx) {
+				return fmt.Errorf("context \"%v\" of \"%v\" in environment \"%v\" not found in kubeconfig\n", ctx, owners[ctx], environment)
+			}
+
+			if len(whitelist) > 0 && !containsString(whitelist, ctx) {
+				return fmt.Errorf("context \"%v\" of \"%v\" in environment \"%v\" is not listed in whitelist\n", ctx, owners[ctx], environment)
+			}
+		}
+	}
+
+	if !usesCurrent {
+		return nil
+	}
+
+	currentCtx, err := currentContext()
+	if err != nil {
+		return err
+	}
+
+	if !containsString(kipProject.WhitelistedContexts(), currentCtx) {
 		fmt.Fprintf(out, "\ncontext: %v is not listed in whitelist\nconfirm context: ", currentCtx)
 		reader := bufio.NewReader(os.Stdin)
 		text, _ := reader.ReadString('\n')
 		text = strings.Replace(text, "\n", "", -1)
 		if text != currentCtx {
-			fmt.Fprintf(out, "input \"%v\" does not match \"%v\"\n", text, currentCtx)
-			return checkAndConfirmContext(out)
+			return fmt.Errorf("input \"%v\" does not match \"%v\"\n", text, currentCtx)
 		}
 	}
 
 	return nil
 }
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
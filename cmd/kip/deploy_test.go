@@ -0,0 +1,90 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"debugged-dev/kip/v1/pkg/project"
+)
+
+func TestDeployStageReportsFailedCharts(t *testing.T) {
+	runner := &project.FakeRunner{}
+	defer useTestProjectWithRunner(t, map[string]string{
+		"kip_config.yaml":                           "template: project\nenvironment: dev\nversion: v0.0.0\nstate:\n  backend: file\n",
+		"deployments/api/Chart.yaml":                "name: api\n",
+		"deployments/web/Chart.yaml":                "name: web\n",
+		"services/shop/kip_config.yaml":             "template: service\nversion: v0.0.0\n",
+		"services/shop/deployments/shop/Chart.yaml": "name: shop\n",
+	}, runner)()
+
+	var stream bytes.Buffer
+	defer func(previous *eventStream) { events = previous }(events)
+	events = &eventStream{}
+	events.enable(&stream)
+
+	runner.On("helm template", "apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n", nil)
+	runner.On("helm upgrade web", "", errors.New("exit status 1"))
+
+	charts, err := kipProject.Charts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	services, err := kipProject.Services()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if deployStage(ioutil.Discard, charts, services, "dev", []string{}, false, false) {
+		t.Error("expected the failed chart to fail the deploy")
+	}
+
+	for _, call := range runner.Calls() {
+		if call.Name == "helm" && call.Args[0] == "upgrade" && call.Args[1] == "shop" {
+			t.Error("expected no deploys after the failed chart")
+		}
+	}
+
+	finished := []event{}
+	for _, line := range strings.Split(strings.TrimSpace(stream.String()), "\n") {
+		var ev event
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatal(err)
+		}
+		if ev.Event == eventFinished {
+			finished = append(finished, ev)
+		}
+	}
+
+	if len(finished) != 3 {
+		t.Fatalf("expected the finished events of api, web and the stage, got %+v", finished)
+	}
+
+	if finished[0].Chart != "api" || finished[0].Status != statusSuccess {
+		t.Errorf("expected api to be deployed, got %+v", finished[0])
+	}
+	if finished[1].Chart != "web" || finished[1].Status != statusFailed {
+		t.Errorf("expected web to fail, got %+v", finished[1])
+	}
+	if finished[2].Chart != "" || finished[2].Status != statusFailed {
+		t.Errorf("expected the deploy stage to fail, got %+v", finished[2])
+	}
+}
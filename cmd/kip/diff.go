@@ -0,0 +1,50 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"io"
+
+	"github.com/spf13/cobra"
+)
+
+func newDiffCmd(out io.Writer) *cobra.Command {
+	o := &deployOptions{diffOnly: true}
+
+	cmd := &cobra.Command{
+		Use:   "diff",
+		Short: "shows the changes a deploy would make",
+		Long: `Renders the charts the same way kip deploy does and prints a unified diff
+	per kubernetes resource against the manifests of the last deploy.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			o.run(out, cmd.Flags().Args())
+		},
+	}
+
+	f := cmd.Flags()
+	f.BoolVarP(&o.all, "all", "a", false, "diff all charts")
+	f.StringVarP(&o.environment, "environment", "e", "", "define build enviroment")
+	f.StringVarP(&o.repository, "repository", "r", "", "repository to tag image with")
+	f.StringVarP(&o.key, "key", "k", "latest", "key to tag latest image with")
+	f.StringArrayVarP(&o.charts, "chart", "c", []string{}, "charts to diff")
+	f.StringArrayVarP(&o.services, "service", "s", []string{}, "services to diff")
+	f.StringVar(&o.since, "since", "", "only diff charts and services with changes since git ref")
+
+	registerServiceAutocomplete(cmd)
+	registerChartAutocomplete(cmd)
+
+	return cmd
+}
@@ -0,0 +1,141 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"debugged-dev/kip/v1/pkg/project"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+const (
+	eventStarted  = "started"
+	eventFinished = "finished"
+
+	stageBuild  = "build"
+	stagePush   = "push"
+	stageDeploy = "deploy"
+	stageScript = "script"
+)
+
+// event is a single line of the --output json event stream
+type event struct {
+	Time        time.Time `json:"time"`
+	Stage       string    `json:"stage"`
+	Event       string    `json:"event"`
+	Environment string    `json:"environment,omitempty"`
+	Service     string    `json:"service,omitempty"`
+	Chart       string    `json:"chart,omitempty"`
+	Script      string    `json:"script,omitempty"`
+	Binding     string    `json:"binding,omitempty"`
+	Status      string    `json:"status,omitempty"`
+	Duration    float64   `json:"duration,omitempty"`
+	Image       string    `json:"image,omitempty"`
+	ImageID     string    `json:"imageId,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// eventStream writes one json object per event, nothing is written until it is enabled
+type eventStream struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+// events is shared by all commands so bp and bpd write a single stream
+var events = &eventStream{}
+
+func (e *eventStream) enable(out io.Writer) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.encoder == nil {
+		e.encoder = json.NewEncoder(out)
+	}
+}
+
+func (e *eventStream) emit(ev event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.encoder == nil {
+		return
+	}
+
+	ev.Time = time.Now().UTC()
+	e.encoder.Encode(ev)
+}
+
+// setupOutput enables the event stream for --output json and returns the writer for the human
+// readable output, which is moved to stderr so stdout only contains events
+func setupOutput(out io.Writer, output string) io.Writer {
+	if output != outputJSON {
+		return out
+	}
+
+	color.NoColor = true
+	events.enable(out)
+
+	return os.Stderr
+}
+
+func stageStatus(results []serviceResult) string {
+	if hasFailures(results) {
+		return statusFailed
+	}
+	return statusSuccess
+}
+
+// runScripts runs the scripts bound to binding with everything they need, the error lists the scripts that failed
+func runScripts(out io.Writer, binding string, environment string) error {
+	names := []string{}
+	for _, script := range projectScripts(out, kipProject, binding, environment) {
+		names = append(names, script.Name)
+	}
+
+	nodes, err := project.ResolveScripts(kipProject, names...)
+	if err != nil {
+		return err
+	}
+
+	_, err = runScriptGraph(out, nodes, 1, true, func(node project.ScriptNode) error {
+		fmt.Fprintf(out, color.BlueString("RUN script: \"%s\"\n"), node.ID)
+		events.emit(event{Stage: stageScript, Event: eventStarted, Environment: environment, Script: node.ID, Binding: binding})
+
+		start := time.Now()
+		err := node.Script.Run(out, []string{})
+
+		finished := event{Stage: stageScript, Event: eventFinished, Environment: environment, Script: node.ID, Binding: binding, Status: statusSuccess, Duration: time.Since(start).Seconds()}
+		if err != nil {
+			finished.Status = statusFailed
+			finished.Error = err.Error()
+		}
+		events.emit(finished)
+
+		return err
+	})
+
+	if err != nil {
+		return fmt.Errorf("%s scripts failed:\n%v", binding, err)
+	}
+
+	return nil
+}
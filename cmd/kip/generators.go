@@ -19,7 +19,7 @@ import (
 	"fmt"
 	"io"
 
-	"debugged-dev/kip/v1/internal/generator"
+	"debugged-dev/kip/v1/pkg/generator"
 
 	"github.com/fatih/color"
 	"github.com/olekukonko/tablewriter"
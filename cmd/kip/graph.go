@@ -0,0 +1,98 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"debugged-dev/kip/v1/pkg/project"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+type graphOptions struct {
+	format string
+}
+
+func newGraphCmd(out io.Writer) *cobra.Command {
+	o := &graphOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "graph",
+		Short: "prints the service dependency graph",
+		Long: `Prints the dependency graph of the services in build order.
+	Services declare the services they build on with dependsOn in their kip_config.yaml.
+	Use --format dot to render the graph with graphviz, for example:
+
+	kip graph --format dot | dot -Tpng > graph.png`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if !hasKipConfig {
+				fmt.Fprintln(out, color.RedString("run this command inside a kip project"))
+				os.Exit(1)
+			}
+
+			services, err := project.SortServices(projectServices(out, kipProject))
+			if err != nil {
+				fmt.Fprintln(out, color.RedString("%v", err))
+				os.Exit(1)
+			}
+
+			exists := map[string]bool{}
+			for _, service := range services {
+				exists[service.Name()] = true
+			}
+
+			switch o.format {
+			case "text":
+				for _, service := range services {
+					dependencies := []string{}
+					for _, dependency := range service.DependsOn() {
+						if !exists[dependency] {
+							dependency = color.RedString("%s (not found)", dependency)
+						}
+						dependencies = append(dependencies, dependency)
+					}
+
+					if len(dependencies) > 0 {
+						fmt.Fprintf(out, "%s -> %s\n", service.Name(), strings.Join(dependencies, ", "))
+					} else {
+						fmt.Fprintf(out, "%s\n", service.Name())
+					}
+				}
+			case "dot":
+				fmt.Fprintln(out, "digraph kip {")
+				for _, service := range services {
+					fmt.Fprintf(out, "  %q;\n", service.Name())
+					for _, dependency := range service.DependsOn() {
+						fmt.Fprintf(out, "  %q -> %q;\n", service.Name(), dependency)
+					}
+				}
+				fmt.Fprintln(out, "}")
+			default:
+				fmt.Fprintf(out, "format \"%s\" not supported, use text or dot\n", o.format)
+				os.Exit(1)
+			}
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&o.format, "format", "f", "text", "output format: text | dot")
+
+	return cmd
+}
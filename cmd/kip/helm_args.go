@@ -16,10 +16,11 @@ limitations under the License.
 package main
 
 import (
+	"debugged-dev/kip/v1/pkg/project"
 	"fmt"
 	"io"
 	"os"
-	"strings"
+	"path/filepath"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
@@ -52,7 +53,7 @@ func newHelmArgsCmd(out io.Writer) *cobra.Command {
 
 			extraArgs := cmd.Flags().Args()
 
-			services := kipProject.Services()
+			services := projectServices(out, kipProject)
 
 			if o.environment == "" {
 				o.environment = kipProject.Environment()
@@ -62,17 +63,11 @@ func newHelmArgsCmd(out io.Writer) *cobra.Command {
 				o.repository, _ = kipProject.Repository(o.environment)
 			}
 
-			imageArgs := []string{}
+			images := []project.ServiceImage{}
 
 			for _, service := range services {
-				if service.HasDockerfile() {
-					var tag string = "latest"
-
-					if o.key != "" {
-						tag = "temp-" + o.key
-					}
-
-					buildID, err := service.GetImageID(tag, o.repository)
+				if service.HasDockerfile(o.environment) {
+					image, err := service.Image(o.repository, o.key, o.environment)
 
 					if err != nil {
 						fmt.Fprintln(out, err)
@@ -80,13 +75,20 @@ func newHelmArgsCmd(out io.Writer) *cobra.Command {
 						os.Exit(1)
 					}
 
-					serviceKey := strings.ReplaceAll(service.Name(), "-", "_")
-
-					imageArgs = append(imageArgs, []string{"--set", "global.services." + serviceKey + ".name=" + service.Name()}...)
-					imageArgs = append(imageArgs, []string{"--set", "global.services." + serviceKey + ".tag=" + buildID}...)
+					images = append(images, image)
 				}
 			}
 
+			valuesPath := filepath.Join(kipProject.Paths().Root, ".kip", fmt.Sprintf("image-values-%s.yaml", o.environment))
+
+			err := project.WriteImageValues(valuesPath, kipProject.ImageValuesPath(), images)
+			if err != nil {
+				fmt.Fprintln(out, err)
+				os.Exit(1)
+			}
+
+			imageArgs := []string{"-f", valuesPath}
+
 			extraArgs = append(extraArgs, imageArgs...)
 			fmt.Print(extraArgs)
 		},
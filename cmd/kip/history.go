@@ -0,0 +1,119 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"debugged-dev/kip/v1/pkg/project"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+type historyOptions struct {
+	chart       string
+	service     string
+	environment string
+}
+
+func newHistoryCmd(out io.Writer) *cobra.Command {
+	o := &historyOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "lists the releases of charts",
+		Long: `Lists the helm release history of a chart, or of all charts of a service.
+	Use kip rollback to return a chart to one of the listed revisions.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if !hasKipConfig {
+				fmt.Fprintln(out, color.RedString("run this command inside a kip project"))
+				os.Exit(1)
+			}
+
+			if o.environment == "" {
+				o.environment = kipProject.Environment()
+			}
+
+			for _, chart := range selectCharts(out, o.chart, o.service) {
+				releases, err := chart.History(o.environment)
+				if err != nil {
+					fmt.Fprintln(out, err)
+					os.Exit(1)
+				}
+
+				fmt.Fprintf(out, "History of chart: %s\n", chart.Name())
+
+				table := tablewriter.NewWriter(color.Output)
+				table.SetHeader([]string{"revision", "updated", "status", "chart", "app version", "description"})
+
+				for _, release := range releases {
+					table.Append([]string{strconv.Itoa(release.Revision), release.Updated, release.Status, release.Chart, release.AppVersion, release.Description})
+				}
+
+				table.Render()
+				fmt.Fprintln(out)
+			}
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&o.chart, "chart", "c", "", "chart to list the releases of")
+	f.StringVarP(&o.service, "service", "s", "", "service to list the releases of")
+	f.StringVarP(&o.environment, "environment", "e", "", "define enviroment")
+
+	registerServiceAutocomplete(cmd)
+	registerChartAutocomplete(cmd)
+
+	return cmd
+}
+
+// selectCharts returns the chart with the name, or all charts of the service when no chart is given
+func selectCharts(out io.Writer, chartName string, serviceName string) []project.Chart {
+	if chartName == "" && serviceName == "" && kipProject.Template() == "project" {
+		fmt.Fprint(out, "specify a chart using -c or a service using -s\n")
+		os.Exit(1)
+	}
+
+	var p project.Project = kipProject
+
+	if serviceName != "" && kipProject.Template() == "project" {
+		service, err := kipProject.GetService(serviceName)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			os.Exit(1)
+		}
+		p = service
+	}
+
+	if chartName == "" {
+		return projectCharts(out, p)
+	}
+
+	for _, chart := range projectCharts(out, p) {
+		if chart.Name() == chartName {
+			return []project.Chart{chart}
+		}
+	}
+
+	fmt.Fprintf(out, "chart \"%s\" does not exist in project\n", chartName)
+	os.Exit(1)
+
+	return nil
+}
@@ -16,22 +16,21 @@ limitations under the License.
 package main
 
 import (
-	"debugged-dev/kip/v1/internal/project"
+	"debugged-dev/kip/v1/pkg/project"
 	"errors"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
+	"sync"
 
 	"github.com/fatih/color"
 	"github.com/joho/godotenv"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var kipProject project.Project
 var hasKipConfig = false
 
-var rootPath, _ = filepath.Abs("/")
 var rootCmd *cobra.Command
 
 func main() {
@@ -40,47 +39,87 @@ func main() {
 	cobra.OnInitialize(initConfig)
 
 	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
+		exit(1)
 	}
+	exit(0)
+}
+
+var (
+	exitFilesMutex sync.Mutex
+	exitFiles      []string
+)
+
+// removeOnExit deletes the file when kip exits, a defer would be skipped by exit
+func removeOnExit(path string) {
+	exitFilesMutex.Lock()
+	defer exitFilesMutex.Unlock()
+	exitFiles = append(exitFiles, path)
+}
+
+// exit removes the temp files of the commands and the values file of the script outputs and exits with code
+func exit(code int) {
+	exitFilesMutex.Lock()
+	for _, path := range exitFiles {
+		os.Remove(path)
+	}
+	exitFilesMutex.Unlock()
+
+	project.RemoveScriptValues()
+	os.Exit(code)
 }
 
 func initConfig() {
 	wd, err := os.Getwd()
 	if err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	kipProject, err = loadKipProject(wd)
+	if err != nil && !errors.Is(err, project.ErrProjectNotFound) {
+		fmt.Fprintln(os.Stderr, color.RedString(err.Error()))
+	}
 
 	hasKipConfig = err == nil
 }
 
 func loadKipProject(path string) (project.Project, error) {
-	var kipProject project.Project
-	var err error
-
-	projectConfig := viper.New()
-	projectConfig.AddConfigPath(path)
-	projectConfig.SetConfigName("kip_config")
-	projectConfig.SetConfigType("yaml")
-
-	if err := projectConfig.ReadInConfig(); err != nil {
-		newPath, err := filepath.Abs(filepath.Join(path, ".."))
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
-		}
-
-		if path == rootPath {
-			return nil, errors.New("kip_config not found")
-		}
-
-		return loadKipProject(newPath)
+	root, err := project.Find(path)
+	if err != nil {
+		return nil, err
 	}
 
 	env, _ := godotenv.Read()
-	kipProject, err = project.GetProject(path, projectConfig, env)
 
-	return kipProject, err
+	return project.Open(root, env, project.ExecRunner{})
+}
+
+// projectServices returns the services of p and exits when their config can not be read
+func projectServices(out io.Writer, p project.Project) []project.ServiceProject {
+	services, err := p.Services()
+	if err != nil {
+		fmt.Fprintln(out, err)
+		exit(1)
+	}
+	return services
+}
+
+// projectCharts returns the charts of p and exits when they can not be read
+func projectCharts(out io.Writer, p project.Project) []project.Chart {
+	charts, err := p.Charts()
+	if err != nil {
+		fmt.Fprintln(out, err)
+		exit(1)
+	}
+	return charts
+}
+
+// projectScripts returns the scripts of p and exits when they can not be read
+func projectScripts(out io.Writer, p project.Project, binding string, environment string) []project.Script {
+	scripts, err := p.GetScripts(binding, environment)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		exit(1)
+	}
+	return scripts
 }
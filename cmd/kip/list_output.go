@@ -0,0 +1,64 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatYAML  = "yaml"
+	formatName  = "name"
+)
+
+func validateListFormat(format string) error {
+	switch format {
+	case formatTable, formatJSON, formatYAML, formatName:
+		return nil
+	default:
+		return fmt.Errorf("output \"%s\" not supported, use table, json, yaml or name", format)
+	}
+}
+
+// writeList writes the items as json or yaml, or one name per line. Tables are rendered by the commands
+func writeList(out io.Writer, format string, items interface{}, names []string) error {
+	switch format {
+	case formatJSON:
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(items)
+	case formatYAML:
+		content, err := yaml.Marshal(items)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(content)
+		return err
+	case formatName:
+		for _, name := range names {
+			fmt.Fprintln(out, name)
+		}
+		return nil
+	default:
+		return validateListFormat(format)
+	}
+}
@@ -16,7 +16,7 @@ limitations under the License.
 package main
 
 import (
-	"debugged-dev/kip/v1/internal/project"
+	"debugged-dev/kip/v1/pkg/project"
 	"errors"
 	"fmt"
 	"io"
@@ -0,0 +1,252 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
+)
+
+const (
+	outputAuto  = ""
+	outputTTY   = "tty"
+	outputPlain = "plain"
+	outputJSON  = "json"
+)
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// progressReporter reports the progress of services handled in parallel, all methods are safe to call from the workerpool
+type progressReporter interface {
+	// Start marks a service as active
+	Start(service string)
+	// Done marks a service as finished
+	Done(service string)
+	// Println prints a log line without breaking the progress output
+	Println(line string)
+	// Stop stops rendering, nothing may be reported afterwards
+	Stop()
+}
+
+// resolveOutput returns the renderer for --output, plain is used when stdout is not a terminal
+func resolveOutput(output string) (string, error) {
+	switch output {
+	case outputAuto:
+		if isatty.IsTerminal(os.Stdout.Fd()) || isatty.IsCygwinTerminal(os.Stdout.Fd()) {
+			return outputTTY, nil
+		}
+		return outputPlain, nil
+	case outputTTY, outputPlain, outputJSON:
+		return output, nil
+	default:
+		return "", fmt.Errorf("output \"%s\" not supported, use tty, plain or json", output)
+	}
+}
+
+func newProgressReporter(out io.Writer, action string, total int, output string) (progressReporter, error) {
+	output, err := resolveOutput(output)
+	if err != nil {
+		return nil, err
+	}
+
+	if output == outputPlain {
+		color.NoColor = true
+		return &plainProgress{out: out, action: action, total: total}, nil
+	}
+
+	if output == outputJSON {
+		return &jsonProgress{out: out, stage: strings.ToLower(action)}, nil
+	}
+
+	p := &ttyProgress{
+		out:     out,
+		action:  action,
+		total:   total,
+		started: map[string]time.Time{},
+		stop:    make(chan struct{}),
+	}
+
+	p.wg.Add(1)
+	go p.loop()
+
+	return p, nil
+}
+
+// progressWriter prints what is written to it as log lines of the progress output
+type progressWriter struct {
+	progress progressReporter
+}
+
+func (w progressWriter) Write(p []byte) (int, error) {
+	w.progress.Println(string(p))
+	return len(p), nil
+}
+
+// plainProgress prints one line per event, meant for CI logs
+type plainProgress struct {
+	mu       sync.Mutex
+	out      io.Writer
+	action   string
+	total    int
+	finished int
+}
+
+func (p *plainProgress) Start(service string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintf(p.out, "%s %s STARTED (%d/%d finished)\n", p.action, service, p.finished, p.total)
+}
+
+func (p *plainProgress) Done(service string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.finished++
+}
+
+func (p *plainProgress) Println(line string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintln(p.out, strings.TrimSuffix(line, "\n"))
+}
+
+func (p *plainProgress) Stop() {}
+
+// jsonProgress reports started services on the event stream, finished services are reported with their result
+type jsonProgress struct {
+	mu    sync.Mutex
+	out   io.Writer
+	stage string
+}
+
+func (p *jsonProgress) Start(service string) {
+	events.emit(event{Stage: p.stage, Event: eventStarted, Service: service})
+}
+
+func (p *jsonProgress) Done(service string) {}
+
+func (p *jsonProgress) Println(line string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintln(p.out, strings.TrimSuffix(line, "\n"))
+}
+
+func (p *jsonProgress) Stop() {}
+
+// ttyProgress renders a live line per active service below the log lines
+type ttyProgress struct {
+	mu       sync.Mutex
+	out      io.Writer
+	action   string
+	total    int
+	finished int
+	active   []string
+	started  map[string]time.Time
+	lines    int
+	frame    int
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+func (p *ttyProgress) loop() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			p.frame++
+			p.clear()
+			p.render()
+			p.mu.Unlock()
+		}
+	}
+}
+
+// clear removes the rendered progress lines, the caller must hold the lock
+func (p *ttyProgress) clear() {
+	for ; p.lines > 0; p.lines-- {
+		fmt.Fprint(p.out, "\x1b[1A\x1b[2K")
+	}
+}
+
+// render draws the progress lines, the caller must hold the lock
+func (p *ttyProgress) render() {
+	spinner := spinnerFrames[p.frame%len(spinnerFrames)]
+
+	fmt.Fprintf(p.out, "%s %d/%d %s\n", spinner, p.finished, p.total, p.action)
+	p.lines = 1
+
+	for _, service := range p.active {
+		d := time.Since(p.started[service]).Round(time.Second)
+		fmt.Fprintf(p.out, "  %s %s %s\n", spinner, service, color.YellowString("%s", d))
+		p.lines++
+	}
+}
+
+func (p *ttyProgress) Start(service string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.started[service] = time.Now()
+	p.active = append(p.active, service)
+	sort.Strings(p.active)
+
+	p.clear()
+	p.render()
+}
+
+func (p *ttyProgress) Done(service string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.finished++
+	p.active = removeStringFromArray(p.active, service)
+	delete(p.started, service)
+
+	p.clear()
+	p.render()
+}
+
+func (p *ttyProgress) Println(line string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.clear()
+	fmt.Fprintln(p.out, strings.TrimSuffix(line, "\n"))
+	p.render()
+}
+
+func (p *ttyProgress) Stop() {
+	close(p.stop)
+	p.wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+}
@@ -16,18 +16,16 @@ limitations under the License.
 package main
 
 import (
-	"debugged-dev/kip/v1/internal/project"
+	"debugged-dev/kip/v1/pkg/project"
 	"fmt"
 	"io"
 	"log"
-	"os"
-	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/fatih/color"
 	"github.com/gammazero/workerpool"
-	"github.com/schollz/progressbar/v3"
 	"github.com/spf13/cobra"
 	"robpike.io/filter"
 )
@@ -40,6 +38,9 @@ type pushOptions struct {
 	key         string
 	debug       bool
 	parallel    int
+	since       string
+	failFast    bool
+	output      string
 }
 
 func newPushCmd(out io.Writer) *cobra.Command {
@@ -55,13 +56,15 @@ func newPushCmd(out io.Writer) *cobra.Command {
 	This application is a tool to generate the needed files
 	to quickly create a Cobra application.`,
 		Run: func(cmd *cobra.Command, args []string) {
+			out := setupOutput(out, o.output)
+
 			if !hasKipConfig {
 				log.Fatalln("run this command inside a kip project")
 			}
 
 			extraArgs := cmd.Flags().Args()
 
-			services := kipProject.Services()
+			services := projectServices(out, kipProject)
 			servicesToPush := []project.ServiceProject{}
 
 			if !o.all && len(o.services) == 0 {
@@ -98,43 +101,41 @@ func newPushCmd(out io.Writer) *cobra.Command {
 						servicesToPush = append(servicesToPush, foundService.(project.ServiceProject))
 					} else {
 						fmt.Fprintf(out, "service \"%s\" does not exist in project\n", serviceName)
-						os.Exit(1)
+						exit(1)
 					}
 				}
 			}
 
+			if o.since != "" {
+				servicesToPush = filterAffectedServices(out, servicesToPush, o.since)
+
+				if len(servicesToPush) == 0 {
+					fmt.Fprintf(out, "no services changed since \"%s\"\n", o.since)
+					return
+				}
+			}
+
 			serviceNames := filter.Apply(servicesToPush, func(s project.ServiceProject) string {
 				return s.Name()
 			}).([]string)
 
 			fmt.Fprintf(out, "Pushing services: %s\n\n", strings.Join(serviceNames, ","))
 
-			prePushscripts := kipProject.GetScripts("pre-push", o.environment)
-
-			if len(prePushscripts) > 0 {
-				for _, script := range prePushscripts {
-					fmt.Fprintf(out, color.BlueString("RUN script: \"%s\"\n"), script.Name)
-
-					err := script.Run(out, []string{})
-					if err != nil {
-						log.Fatalf("error running script \"%s\": %v", script.Name, err)
-					}
-				}
+			if err := runScripts(out, "pre-push", o.environment); err != nil {
+				fmt.Fprintln(out, color.RedString("%v", err))
+				exit(1)
 			}
 
-			pushServices(out, servicesToPush, o.repository, o.key, extraArgs, o.environment, o.parallel, o.debug)
-
-			postBuildscripts := kipProject.GetScripts("post-push", o.environment)
+			results := pushServices(out, servicesToPush, o.repository, o.key, extraArgs, o.environment, o.parallel, o.debug, o.failFast, o.output)
+			renderResults(out, "PUSH", results)
 
-			if len(postBuildscripts) > 0 {
-				for _, script := range postBuildscripts {
-					fmt.Fprintf(out, color.BlueString("RUN script: \"%s\"\n"), script.Name)
+			if hasFailures(results) {
+				exit(1)
+			}
 
-					err := script.Run(out, []string{})
-					if err != nil {
-						log.Fatalf("error running script \"%s\": %v", script.Name, err)
-					}
-				}
+			if err := runScripts(out, "post-push", o.environment); err != nil {
+				fmt.Fprintln(out, color.RedString("%v", err))
+				exit(1)
 			}
 		},
 	}
@@ -147,78 +148,101 @@ func newPushCmd(out io.Writer) *cobra.Command {
 	f.StringArrayVarP(&o.services, "service", "s", []string{}, "services to push")
 	f.BoolVarP(&o.debug, "debug", "d", false, "debug output")
 	f.IntVarP(&o.parallel, "parallel", "p", 4, "number of images to push parallel")
+	f.StringVar(&o.since, "since", "", "only push services with changes since git ref")
+	f.BoolVar(&o.failFast, "fail-fast", false, "cancel queued pushes after the first failure")
+	f.StringVarP(&o.output, "output", "o", "", "output: tty, plain or json events (default plain when stdout is not a terminal)")
 
 	registerServiceAutocomplete(cmd)
 
 	return cmd
 }
 
-func pushServices(out io.Writer, services []project.ServiceProject, repository string, key string, args []string, environment string, parallel int, debug bool) {
-	wp := workerpool.New(parallel)
+func pushServices(out io.Writer, services []project.ServiceProject, repository string, key string, args []string, environment string, parallel int, debug bool, failFast bool, output string) []serviceResult {
+	total := 0
+	for _, service := range services {
+		if service.HasDockerfile(environment) {
+			total++
+		}
+	}
 
-	bar := progressbar.NewOptions(-1,
-		progressbar.OptionSetWriter(out),
-		progressbar.OptionSpinnerType(14),
-		progressbar.OptionClearOnFinish(),
-		progressbar.OptionUseANSICodes(true),
-	)
+	progress, err := newProgressReporter(out, "PUSH", total, output)
+	if err != nil {
+		fmt.Fprintln(out, color.RedString("%v", err))
+		exit(1)
+	}
+
+	wp := workerpool.New(parallel)
 
-	finished := 0
-	pushing := []string{}
-	total := 0
 	start := time.Now()
+	results := &serviceResults{stage: stagePush, environment: environment}
 
-	go func() {
-		for !bar.IsFinished() {
-			bar.RenderBlank()
-			time.Sleep(time.Millisecond * 100)
-		}
-	}()
+	events.emit(event{Stage: stagePush, Event: eventStarted, Environment: environment})
+
+	var mu sync.Mutex
+	cancelled := false
 
 	for _, service := range services {
 		service := service
-		if service.HasDockerfile() {
-			total++
+		if service.HasDockerfile(environment) {
 			wp.Submit(func() {
-				serviceStart := time.Now()
-				pushing = append(pushing, service.Name())
-				sort.Strings(pushing)
-				bar.Describe(fmt.Sprintf("%v/%v Pusing (%v)", finished, total, strings.Join(pushing, ", ")))
+				// --fail-fast cancels everything that did not start yet
+				mu.Lock()
+				if cancelled {
+					mu.Unlock()
+					results.add(serviceResult{service: service.Name(), status: statusCancelled})
+					return
+				}
+				mu.Unlock()
 
-				defer func() {
-					finished++
-					pushing = removeStringFromArray(pushing, service.Name())
-					bar.Describe(fmt.Sprintf("%v/%v Pusing (%v)", finished, total, strings.Join(pushing, ", ")))
-				}()
+				serviceStart := time.Now()
+				progress.Start(service.Name())
+				defer progress.Done(service.Name())
 
-				output, pushErr := service.Push(repository, key, args, environment)
+				pushOutput, pushErr := service.Push(repository, key, args, environment)
 				d := time.Since(serviceStart)
 				d = d.Round(time.Millisecond)
 
+				result := serviceResult{service: service.Name(), status: statusSuccess, duration: d}
+
 				if pushErr == nil {
-					bar.Clear()
-					fmt.Fprintf(out, color.BlueString("PUSH %s %s %s\n"), service.Name(), color.GreenString("SUCCESS"), color.YellowString("%s", d))
+					if image, err := service.Image(repository, key, environment); err == nil {
+						result.image = image.Reference()
+						result.imageID = image.ImageID
+					}
+
+					progress.Println(fmt.Sprintf(color.BlueString("PUSH %s %s %s"), service.Name(), color.GreenString("SUCCESS"), color.YellowString("%s", d)))
 					if debug {
-						bar.Clear()
-						fmt.Fprintf(out, "%v\n", string(output))
+						progress.Println(string(pushOutput))
 					}
 				} else {
-					bar.Clear()
-					fmt.Fprintf(out, color.BlueString("PUSH %s %s %s\n"), service.Name(), color.RedString("FAILED"), color.YellowString("%s", d))
-					bar.Clear()
-					fmt.Fprintf(out, "%v\n", string(output))
+					result.status = statusFailed
+					result.message = pushErr.Error()
+
+					mu.Lock()
+					cancelled = cancelled || failFast
+					mu.Unlock()
+
+					progress.Println(fmt.Sprintf(color.BlueString("PUSH %s %s %s"), service.Name(), color.RedString("FAILED"), color.YellowString("%s", d)))
+					progress.Println(string(pushOutput))
 				}
+
+				results.add(result)
 			})
 		} else {
-			bar.Clear()
-			fmt.Fprintf(out, color.BlueString("SKIP service: \"%s\" no Dockerfile\n"), service.Name())
+			progress.Println(fmt.Sprintf(color.BlueString("SKIP service: \"%s\" no Dockerfile"), service.Name()))
+			results.add(serviceResult{service: service.Name(), status: statusSkipped, message: "no Dockerfile"})
 		}
 	}
 
 	wp.StopWait()
+	progress.Stop()
 	d := time.Since(start)
 	d = d.Round(time.Millisecond)
-	bar.Finish()
 
 	fmt.Fprintf(out, color.GreenString("PUSH %s\n"), color.YellowString("%s", d))
+
+	list := results.list()
+	events.emit(event{Stage: stagePush, Event: eventFinished, Environment: environment, Status: stageStatus(list), Duration: d.Seconds()})
+
+	return list
 }
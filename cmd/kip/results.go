@@ -0,0 +1,144 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+)
+
+const (
+	statusSuccess   = "SUCCESS"
+	statusUnchanged = "UNCHANGED"
+	statusFailed    = "FAILED"
+	statusSkipped   = "SKIPPED"
+	statusCancelled = "CANCELLED"
+	statusWarning   = "WARNING"
+)
+
+// serviceResult is the outcome of building or pushing a single service
+type serviceResult struct {
+	service  string
+	status   string
+	duration time.Duration
+	image    string
+	imageID  string
+	message  string
+}
+
+func (r serviceResult) failed() bool {
+	return r.status == statusFailed || r.status == statusCancelled
+}
+
+// serviceResults collects the results of the workerpool goroutines
+type serviceResults struct {
+	mu          sync.Mutex
+	stage       string
+	environment string
+	results     []serviceResult
+}
+
+// add collects the result and reports it on the event stream
+func (r *serviceResults) add(result serviceResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results = append(r.results, result)
+
+	ev := event{
+		Stage:       r.stage,
+		Event:       eventFinished,
+		Environment: r.environment,
+		Service:     result.service,
+		Status:      result.status,
+		Duration:    result.duration.Seconds(),
+		Image:       result.image,
+		ImageID:     result.imageID,
+	}
+
+	if result.failed() {
+		ev.Error = result.message
+	}
+
+	events.emit(ev)
+}
+
+func (r *serviceResults) list() []serviceResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	results := append([]serviceResult{}, r.results...)
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].service < results[j].service
+	})
+
+	return results
+}
+
+func hasFailures(results []serviceResult) bool {
+	for _, result := range results {
+		if result.failed() {
+			return true
+		}
+	}
+	return false
+}
+
+func hasWarnings(results []serviceResult) bool {
+	for _, result := range results {
+		if result.status == statusWarning {
+			return true
+		}
+	}
+	return false
+}
+
+func renderResults(out io.Writer, title string, results []serviceResult) {
+	if len(results) == 0 {
+		return
+	}
+
+	fmt.Fprintf(out, "\n%s summary\n", title)
+
+	table := tablewriter.NewWriter(out)
+	table.SetHeader([]string{"service", "status", "duration", "image"})
+
+	for _, result := range results {
+		status := result.status
+
+		switch {
+		case result.failed():
+			status = color.RedString(status)
+		case result.status == statusSkipped, result.status == statusWarning:
+			status = color.YellowString(status)
+		default:
+			status = color.GreenString(status)
+		}
+
+		if result.message != "" {
+			status = fmt.Sprintf("%s (%s)", status, result.message)
+		}
+
+		table.Append([]string{result.service, status, result.duration.Round(time.Millisecond).String(), result.image})
+	}
+
+	table.Render()
+}
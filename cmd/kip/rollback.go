@@ -0,0 +1,102 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+type rollbackOptions struct {
+	chart       string
+	service     string
+	environment string
+}
+
+func newRollbackCmd(out io.Writer) *cobra.Command {
+	o := &rollbackOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "rollback [revision]",
+		Short: "rolls charts back to an earlier revision",
+		Long: `Rolls a chart, or all charts of a service, back to a revision listed by kip history.
+	Without a revision the charts are rolled back to their previous revision.
+	The saved deploy state is updated so the next kip deploy compares against the running release.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 1 {
+				return errors.New("accepts at most one revision argument")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			if !hasKipConfig {
+				fmt.Fprintln(out, color.RedString("run this command inside a kip project"))
+				os.Exit(1)
+			}
+
+			revision := 0
+
+			if len(args) == 1 {
+				var err error
+				revision, err = strconv.Atoi(args[0])
+				if err != nil || revision < 1 {
+					fmt.Fprintf(out, "invalid revision \"%s\"\n", args[0])
+					os.Exit(1)
+				}
+			}
+
+			if o.environment == "" {
+				o.environment = kipProject.Environment()
+			}
+
+			charts := selectCharts(out, o.chart, o.service)
+
+			err := checkAndConfirmContext(out, o.environment, charts)
+			if err != nil {
+				fmt.Fprint(out, err)
+				os.Exit(1)
+			}
+
+			for _, chart := range charts {
+				fmt.Fprintf(out, color.BlueString("ROLLBACK chart: %s: %s\n"), chart.Name(), color.YellowString(o.environment))
+
+				err := chart.Rollback(out, o.environment, revision)
+				if err != nil {
+					fmt.Fprintln(out, err)
+					os.Exit(1)
+				}
+
+				fmt.Fprintf(out, color.BlueString("ROLLBACK chart: %s %s\n\n"), chart.Name(), color.GreenString("SUCCESS"))
+			}
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&o.chart, "chart", "c", "", "chart to roll back")
+	f.StringVarP(&o.service, "service", "s", "", "service to roll back")
+	f.StringVarP(&o.environment, "environment", "e", "", "define enviroment")
+
+	registerServiceAutocomplete(cmd)
+	registerChartAutocomplete(cmd)
+
+	return cmd
+}
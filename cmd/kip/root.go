@@ -26,7 +26,7 @@ const (
 __kip_get_script()
 {
     local kip_out
-    if kip_out=$(kip script list -s); then
+    if kip_out=$(kip script list -o name); then
         COMPREPLY+=( $( compgen -W "${kip_out[*]}" -- "$cur" ) )
     fi
 }
@@ -76,6 +76,10 @@ to quickly create a Cobra application.`,
 		newHelmArgsCmd(out),
 		newBuildPushDeployCmd(out),
 		newBuildPushCmd(out),
+		newGraphCmd(out),
+		newDiffCmd(out),
+		newHistoryCmd(out),
+		newRollbackCmd(out),
 	)
 
 	return cmd
@@ -88,7 +92,7 @@ func registerServiceAutocomplete(cmd *cobra.Command) {
 			return []string{}, cobra.ShellCompDirectiveDefault
 		}
 
-		services := kipProject.Services()
+		services, _ := kipProject.Services()
 		suggestions := []string{}
 
 		for _, service := range services {
@@ -101,7 +105,7 @@ func registerServiceAutocomplete(cmd *cobra.Command) {
 
 func registerChartAutocomplete(cmd *cobra.Command) {
 	cmd.RegisterFlagCompletionFunc("chart", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-		chart := kipProject.Charts()
+		chart, _ := kipProject.Charts()
 		suggestions := []string{}
 
 		for _, chart := range chart {
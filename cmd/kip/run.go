@@ -16,20 +16,28 @@ limitations under the License.
 package main
 
 import (
-	"debugged-dev/kip/v1/internal/project"
+	"bytes"
+	"debugged-dev/kip/v1/pkg/project"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/fatih/color"
+	"github.com/gammazero/workerpool"
 	"github.com/spf13/cobra"
 	"robpike.io/filter"
 )
 
 type addRunOptions struct {
-	service string
+	services    []string
+	allServices bool
+	parallel    int
 }
 
 func newRunCmd(out io.Writer) *cobra.Command {
@@ -37,7 +45,7 @@ func newRunCmd(out io.Writer) *cobra.Command {
 
 	var scriptNames []string
 	if kipProject != nil {
-		scripts := kipProject.GetScripts("", "")
+		scripts := projectScripts(out, kipProject, "", "")
 		scriptNames = filter.Apply(scripts, func(s project.Script) string {
 			return s.Name
 		}).([]string)
@@ -61,7 +69,7 @@ func newRunCmd(out io.Writer) *cobra.Command {
 		Run: func(cmd *cobra.Command, args []string) {
 			if !hasKipConfig {
 				fmt.Fprintln(out, color.RedString("run this command inside a kip project"))
-				os.Exit(1)
+				exit(1)
 			}
 
 			scriptName := args[0]
@@ -74,24 +82,46 @@ func newRunCmd(out io.Writer) *cobra.Command {
 				extraArgs = f.Args()[f.ArgsLenAtDash():]
 			}
 
+			if o.allServices || len(o.services) > 1 || (len(o.services) == 1 && isServicePattern(o.services[0])) {
+				if kipProject.Template() != "project" {
+					fmt.Fprintln(out, color.RedString("--all-services and multiple --service values only work in a project"))
+					exit(1)
+				}
+
+				if code := runInServices(out, scriptName, o.selectServices(out), extraArgs, o.parallel); code != 0 {
+					exit(code)
+				}
+				return
+			}
+
 			var err error
-			project := kipProject
+			scope := kipProject
 
-			if o.service != "" && kipProject.Template() == "project" {
-				project, err = kipProject.GetService(o.service)
+			if len(o.services) == 1 && kipProject.Template() == "project" {
+				scope, err = kipProject.GetService(o.services[0])
 
 				if err != nil {
 					log.Fatal(err)
 				}
 			}
 
-			script, err := project.GetScript(scriptName)
+			nodes, err := project.ResolveScripts(scope, scriptName)
 
 			if err != nil {
 				log.Fatal(err)
 			}
 
-			err = script.Run(out, extraArgs)
+			// the args after -- are passed to the script that was asked for, not to what it needs
+			target := nodes[len(nodes)-1].ID
+
+			_, err = runScriptGraph(out, nodes, o.parallel, true, func(node project.ScriptNode) error {
+				fmt.Fprintf(out, color.BlueString("RUN script: \"%s\"\n"), node.ID)
+
+				if node.ID == target {
+					return node.Script.Run(out, extraArgs)
+				}
+				return node.Script.Run(out, []string{})
+			})
 
 			if err != nil {
 				log.Fatal(err)
@@ -102,7 +132,331 @@ func newRunCmd(out io.Writer) *cobra.Command {
 
 	f := cmd.Flags()
 
-	f.StringVarP(&o.service, "service", "s", "", "service of script")
+	f.StringArrayVarP(&o.services, "service", "s", []string{}, "services to run the script in, accepts globs like \"api-*\"")
+	f.BoolVar(&o.allServices, "all-services", false, "run the script in every service that defines it")
+	f.IntVarP(&o.parallel, "parallel", "p", 1, "number of independent scripts to run in parallel")
 
 	return cmd
 }
+
+// isServicePattern reports if the --service value is a glob
+func isServicePattern(value string) bool {
+	return strings.ContainsAny(value, "*?[")
+}
+
+// selectServices returns the services matching --service, every service for --all-services
+func (o *addRunOptions) selectServices(out io.Writer) []project.ServiceProject {
+	services := projectServices(out, kipProject)
+
+	if o.allServices {
+		if len(o.services) > 0 {
+			fmt.Fprintf(out, "WARN: --service is ignored when --all-services is used\n")
+		}
+		return services
+	}
+
+	selected := []project.ServiceProject{}
+	seen := map[string]bool{}
+
+	for _, pattern := range o.services {
+		matched := false
+
+		for _, service := range services {
+			ok, err := path.Match(pattern, service.Name())
+			if err != nil {
+				fmt.Fprintln(out, color.RedString("invalid service pattern \"%s\": %v", pattern, err))
+				exit(1)
+			}
+
+			if ok {
+				matched = true
+				if !seen[service.Name()] {
+					seen[service.Name()] = true
+					selected = append(selected, service)
+				}
+			}
+		}
+
+		if !matched {
+			fmt.Fprintf(out, "service \"%s\" does not exist in project\n", pattern)
+			exit(1)
+		}
+	}
+
+	return selected
+}
+
+// exitCodeWarning is the exit code of runs where scripts only failed with continueOnError
+const exitCodeWarning = 2
+
+// runInServices runs the script in every service that defines it and prints a summary, it returns the exit
+// code: 1 when the script failed in a service, exitCodeWarning when it only failed with continueOnError.
+// A failure does not stop the script in other services
+func runInServices(out io.Writer, scriptName string, services []project.ServiceProject, args []string, parallel int) int {
+	results := &serviceResults{stage: stageScript}
+	targets := []string{}
+
+	for _, service := range services {
+		if _, err := service.GetScript(scriptName); errors.Is(err, project.ErrScriptNotFound) {
+			results.add(serviceResult{service: service.Name(), status: statusSkipped, message: "no script " + scriptName})
+			continue
+		} else if err != nil {
+			fmt.Fprintln(out, color.RedString("%v", err))
+			exit(1)
+		}
+
+		targets = append(targets, service.Name()+":"+scriptName)
+	}
+
+	if len(targets) == 0 {
+		fmt.Fprintln(out, color.RedString("no service defines the script \"%s\"", scriptName))
+		return 1
+	}
+
+	nodes, err := project.ResolveScripts(kipProject, targets...)
+	if err != nil {
+		fmt.Fprintln(out, color.RedString("%v", err))
+		exit(1)
+	}
+
+	isTarget := map[string]bool{}
+	for _, target := range targets {
+		isTarget[target] = true
+	}
+
+	width := 0
+	for _, node := range nodes {
+		if owner := scriptOwner(node.ID); len(owner) > width {
+			width = len(owner)
+		}
+	}
+
+	var outMu sync.Mutex
+	var durationsMu sync.Mutex
+	durations := map[string]time.Duration{}
+
+	outcomes, _ := runScriptGraph(out, nodes, parallel, false, func(node project.ScriptNode) error {
+		prefix := color.CyanString("%-*s | ", width, scriptOwner(node.ID))
+		stdout := &prefixWriter{mu: &outMu, out: out, prefix: prefix}
+		stderr := &prefixWriter{mu: &outMu, out: os.Stderr, prefix: prefix}
+		defer stdout.Flush()
+		defer stderr.Flush()
+
+		fmt.Fprintf(stdout, color.BlueString("RUN script: \"%s\"\n"), node.ID)
+
+		scriptArgs := []string{}
+		if isTarget[node.ID] {
+			scriptArgs = args
+		}
+
+		start := time.Now()
+		err := node.Script.RunOutput(stdout, stderr, scriptArgs)
+
+		durationsMu.Lock()
+		durations[node.ID] = time.Since(start)
+		durationsMu.Unlock()
+
+		return err
+	})
+
+	for _, target := range targets {
+		result := serviceResult{service: scriptOwner(target), status: statusSuccess, duration: durations[target]}
+
+		err, finished := outcomes[target]
+
+		switch {
+		case !finished:
+			result.status = statusCancelled
+		case errors.Is(err, errNeedsFailed):
+			result.status = statusCancelled
+			result.message = err.Error()
+		case errors.Is(err, errContinuedOnError):
+			result.status = statusWarning
+			result.message = err.Error()
+		case err != nil:
+			result.status = statusFailed
+			result.message = err.Error()
+		}
+
+		results.add(result)
+	}
+
+	list := results.list()
+	renderResults(out, "RUN", list)
+
+	switch {
+	case hasFailures(list):
+		return 1
+	case hasWarnings(list):
+		return exitCodeWarning
+	}
+	return 0
+}
+
+// scriptOwner returns the service of a script, scripts of the project that services need belong to the project
+func scriptOwner(id string) string {
+	if i := strings.Index(id, ":"); i != -1 {
+		return id[:i]
+	}
+	return kipProject.Name()
+}
+
+// prefixWriter writes whole lines with the prefix, so the output of scripts running in parallel does not mix
+type prefixWriter struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i == -1 {
+			break
+		}
+
+		if _, err := fmt.Fprintf(w.out, "%s%s", w.prefix, w.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// Flush writes the last line when it does not end with a newline
+func (w *prefixWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.Write([]byte("\n"))
+	}
+}
+
+// errNeedsFailed is the outcome of scripts that did not run because a script they need failed
+var errNeedsFailed = errors.New("needs failed")
+
+// errContinuedOnError is the outcome of continueOnError scripts that failed, and of composite scripts with
+// such a step. The scripts that need them still run
+var errContinuedOnError = errors.New("failed, continued on error")
+
+// runScriptGraph runs every script once the scripts it needs finished, at most parallel at a time.
+// Composite scripts only wait for their steps and scripts whose needs failed are skipped. With failFast
+// no new scripts are started after a failure, unless the script that failed has continueOnError.
+// The outcomes contain the error of every script that finished or was skipped
+func runScriptGraph(out io.Writer, nodes []project.ScriptNode, parallel int, failFast bool, run func(node project.ScriptNode) error) (map[string]error, error) {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	wp := workerpool.New(parallel)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errs := []string{}
+	outcomes := map[string]error{}
+	stopped := false
+	waiting := map[string]int{}
+	dependents := map[string][]project.ScriptNode{}
+
+	for _, node := range nodes {
+		waiting[node.ID] = len(node.Needs)
+		for _, need := range node.Needs {
+			dependents[need] = append(dependents[need], node)
+		}
+	}
+
+	var submit func(node project.ScriptNode)
+
+	done := func(node project.ScriptNode, err error) {
+		ready := []project.ScriptNode{}
+
+		mu.Lock()
+		outcomes[node.ID] = err
+		if err != nil && !errors.Is(err, errNeedsFailed) && !errors.Is(err, errContinuedOnError) {
+			errs = append(errs, fmt.Sprintf("script \"%s\": %v", node.ID, err))
+			stopped = stopped || failFast
+		}
+		for _, dependent := range dependents[node.ID] {
+			waiting[dependent.ID]--
+			if waiting[dependent.ID] == 0 && !stopped {
+				ready = append(ready, dependent)
+			}
+		}
+		mu.Unlock()
+
+		for _, dependent := range ready {
+			submit(dependent)
+		}
+
+		wg.Done()
+	}
+
+	submit = func(node project.ScriptNode) {
+		wg.Add(1)
+
+		mu.Lock()
+		failedNeeds := []string{}
+		continuedNeeds := []string{}
+		for _, need := range node.Needs {
+			if err := outcomes[need]; errors.Is(err, errContinuedOnError) {
+				continuedNeeds = append(continuedNeeds, need)
+			} else if err != nil {
+				failedNeeds = append(failedNeeds, need)
+			}
+		}
+		mu.Unlock()
+
+		if len(failedNeeds) > 0 {
+			done(node, fmt.Errorf("%w: %s", errNeedsFailed, strings.Join(failedNeeds, ", ")))
+			return
+		}
+
+		if node.Composite() {
+			if len(continuedNeeds) > 0 {
+				done(node, fmt.Errorf("%w: %s", errContinuedOnError, strings.Join(continuedNeeds, ", ")))
+				return
+			}
+			done(node, nil)
+			return
+		}
+
+		wp.Submit(func() {
+			mu.Lock()
+			isStopped := stopped
+			mu.Unlock()
+
+			if isStopped {
+				wg.Done()
+				return
+			}
+
+			err := run(node)
+			if err != nil && node.Script.ContinueOnError {
+				fmt.Fprintln(out, color.YellowString("WARN script \"%s\" failed, continuing: %v", node.ID, err))
+				err = fmt.Errorf("%w: %v", errContinuedOnError, err)
+			}
+
+			done(node, err)
+		})
+	}
+
+	for _, node := range nodes {
+		if len(node.Needs) == 0 {
+			submit(node)
+		}
+	}
+
+	wg.Wait()
+	wp.StopWait()
+
+	if len(errs) > 0 {
+		return outcomes, errors.New(strings.Join(errs, "\n"))
+	}
+
+	return outcomes, nil
+}
@@ -0,0 +1,390 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"debugged-dev/kip/v1/pkg/project"
+	"github.com/fatih/color"
+)
+
+func scriptNode(id string, needs ...string) project.ScriptNode {
+	return project.ScriptNode{ID: id, Script: project.Script{Name: id, Command: "./" + id + ".sh"}, Needs: needs}
+}
+
+func compositeNode(id string, steps ...string) project.ScriptNode {
+	return project.ScriptNode{ID: id, Script: project.Script{Name: id, Steps: steps}, Needs: steps}
+}
+
+// fakeScripts records the scripts runScriptGraph runs and fails the ones listed in failing
+type fakeScripts struct {
+	mu      sync.Mutex
+	ran     []string
+	failing map[string]bool
+}
+
+func (f *fakeScripts) run(node project.ScriptNode) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.ran = append(f.ran, node.ID)
+	if f.failing[node.ID] {
+		return errors.New("exit status 1")
+	}
+	return nil
+}
+
+func TestRunScriptGraph(t *testing.T) {
+	continueOnError := scriptNode("lint")
+	continueOnError.Script.ContinueOnError = true
+
+	tests := []struct {
+		name        string
+		nodes       []project.ScriptNode
+		parallel    int
+		failFast    bool
+		failing     []string
+		ran         []string
+		needsFailed []string
+		err         string
+	}{
+		{
+			name:     "needs run first",
+			nodes:    []project.ScriptNode{scriptNode("setup"), scriptNode("migrate", "setup"), scriptNode("seed", "migrate")},
+			parallel: 4,
+			failFast: true,
+			ran:      []string{"setup", "migrate", "seed"},
+		},
+		{
+			name:     "composite scripts only wait for their steps",
+			nodes:    []project.ScriptNode{scriptNode("setup"), scriptNode("lint", "setup"), scriptNode("test", "setup"), compositeNode("ci", "lint", "test"), scriptNode("report", "ci")},
+			parallel: 1,
+			failFast: true,
+			ran:      []string{"setup", "lint", "test", "report"},
+		},
+		{
+			name:     "no new scripts after a failure",
+			nodes:    []project.ScriptNode{scriptNode("lint"), scriptNode("test"), scriptNode("build")},
+			parallel: 1,
+			failFast: true,
+			failing:  []string{"lint"},
+			ran:      []string{"lint"},
+			err:      "script \"lint\": exit status 1",
+		},
+		{
+			name:     "independent scripts run after a failure without failFast",
+			nodes:    []project.ScriptNode{scriptNode("lint"), scriptNode("test"), scriptNode("build")},
+			parallel: 1,
+			failing:  []string{"lint"},
+			ran:      []string{"lint", "test", "build"},
+			err:      "script \"lint\": exit status 1",
+		},
+		{
+			name:        "failed needs are propagated",
+			nodes:       []project.ScriptNode{scriptNode("migrate"), scriptNode("seed", "migrate"), compositeNode("ci", "seed"), scriptNode("report", "ci"), scriptNode("lint")},
+			parallel:    1,
+			failing:     []string{"migrate"},
+			ran:         []string{"migrate", "lint"},
+			needsFailed: []string{"ci", "report", "seed"},
+			err:         "script \"migrate\": exit status 1",
+		},
+		{
+			name:     "continueOnError does not stop the scripts that need it",
+			nodes:    []project.ScriptNode{continueOnError, scriptNode("test", "lint")},
+			parallel: 1,
+			failFast: true,
+			failing:  []string{"lint"},
+			ran:      []string{"lint", "test"},
+		},
+		{
+			name:     "composite scripts with a continueOnError step do not stop the scripts that need them",
+			nodes:    []project.ScriptNode{continueOnError, compositeNode("ci", "lint"), scriptNode("report", "ci")},
+			parallel: 1,
+			failFast: true,
+			failing:  []string{"lint"},
+			ran:      []string{"lint", "report"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scripts := &fakeScripts{failing: map[string]bool{}}
+			for _, id := range test.failing {
+				scripts.failing[id] = true
+			}
+
+			outcomes, err := runScriptGraph(ioutil.Discard, test.nodes, test.parallel, test.failFast, scripts.run)
+
+			if test.err == "" && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			} else if test.err != "" && (err == nil || err.Error() != test.err) {
+				t.Errorf("expected the error %q, got %v", test.err, err)
+			}
+
+			// only the needs order is fixed when scripts run in parallel
+			if test.parallel == 1 && !reflect.DeepEqual(scripts.ran, test.ran) {
+				t.Errorf("expected the scripts %v to run, got %v", test.ran, scripts.ran)
+			}
+
+			if test.parallel > 1 {
+				position := map[string]int{}
+				for i, id := range scripts.ran {
+					position[id] = i
+				}
+				for _, node := range test.nodes {
+					for _, need := range node.Needs {
+						if position[need] > position[node.ID] {
+							t.Errorf("expected %s to run before %s, got %v", need, node.ID, scripts.ran)
+						}
+					}
+				}
+				if len(scripts.ran) != len(test.ran) {
+					t.Errorf("expected the scripts %v to run, got %v", test.ran, scripts.ran)
+				}
+			}
+
+			needsFailed := []string{}
+			for id, outcome := range outcomes {
+				if errors.Is(outcome, errNeedsFailed) {
+					needsFailed = append(needsFailed, id)
+				}
+			}
+			sort.Strings(needsFailed)
+
+			if len(test.needsFailed) > 0 || len(needsFailed) > 0 {
+				if !reflect.DeepEqual(needsFailed, test.needsFailed) {
+					t.Errorf("expected the needs of %v to have failed, got %v", test.needsFailed, needsFailed)
+				}
+			}
+		})
+	}
+}
+
+func TestRunParallelFlag(t *testing.T) {
+	tests := []struct {
+		args     []string
+		parallel string
+		rest     []string
+	}{
+		{args: []string{"ci"}, parallel: "1", rest: []string{"ci"}},
+		{args: []string{"-p", "2", "ci"}, parallel: "2", rest: []string{"ci"}},
+		{args: []string{"--parallel", "8", "ci"}, parallel: "8", rest: []string{"ci"}},
+		{args: []string{"--parallel=3", "ci"}, parallel: "3", rest: []string{"ci"}},
+	}
+
+	for _, test := range tests {
+		t.Run(strings.Join(test.args, " "), func(t *testing.T) {
+			cmd := newRunCmd(ioutil.Discard)
+			if err := cmd.ParseFlags(test.args); err != nil {
+				t.Fatal(err)
+			}
+
+			if parallel := cmd.Flags().Lookup("parallel").Value.String(); parallel != test.parallel {
+				t.Errorf("expected --parallel %s, got %s", test.parallel, parallel)
+			}
+
+			if rest := cmd.Flags().Args(); !reflect.DeepEqual(rest, test.rest) {
+				t.Errorf("expected the args %v, got %v", test.rest, rest)
+			}
+		})
+	}
+}
+
+// useTestProject writes the files to a temporary project and makes it the kip project of the commands
+func useTestProject(t *testing.T, files map[string]string) func() {
+	t.Helper()
+	return useTestProjectWithRunner(t, files, project.ExecRunner{})
+}
+
+// useTestProjectWithRunner is useTestProject with the runner of the commands kip starts, e.g. a FakeRunner
+func useTestProjectWithRunner(t *testing.T, files map[string]string, runner project.Runner) func() {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "kip-cmd-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p, err := project.Open(dir, map[string]string{}, runner)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	previous, noColor := kipProject, color.NoColor
+	kipProject, color.NoColor = p, true
+
+	return func() {
+		kipProject, color.NoColor = previous, noColor
+		os.RemoveAll(dir)
+	}
+}
+
+var servicesWithScripts = map[string]string{
+	"kip_config.yaml":                    "template: project\nenvironment: dev\nversion: v0.0.0\n",
+	"services/api/kip_config.yaml":       "template: service\nversion: v0.0.0\nscripts:\n  - name: test\n    run: echo api ok\n",
+	"services/api-admin/kip_config.yaml": "template: service\nversion: v0.0.0\nscripts:\n  - name: test\n    run: echo admin broken; exit 3\n",
+	"services/docs/kip_config.yaml":      "template: service\nversion: v0.0.0\n",
+	"services/web/kip_config.yaml":       "template: service\nversion: v0.0.0\nscripts:\n  - name: test\n    run: printf 'web ok'\n",
+}
+
+func TestSelectServices(t *testing.T) {
+	defer useTestProject(t, servicesWithScripts)()
+
+	tests := []struct {
+		name     string
+		options  addRunOptions
+		expected []string
+	}{
+		{name: "all services", options: addRunOptions{allServices: true}, expected: []string{"api", "api-admin", "docs", "web"}},
+		{name: "glob", options: addRunOptions{services: []string{"api*"}}, expected: []string{"api", "api-admin"}},
+		{name: "character class", options: addRunOptions{services: []string{"[dw]*"}}, expected: []string{"docs", "web"}},
+		{name: "services matched twice are selected once", options: addRunOptions{services: []string{"web", "api*", "api"}}, expected: []string{"web", "api", "api-admin"}},
+		{name: "--service is ignored with --all-services", options: addRunOptions{allServices: true, services: []string{"web"}}, expected: []string{"api", "api-admin", "docs", "web"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			names := []string{}
+			for _, service := range test.options.selectServices(ioutil.Discard) {
+				names = append(names, service.Name())
+			}
+
+			if !reflect.DeepEqual(names, test.expected) {
+				t.Errorf("expected the services %v, got %v", test.expected, names)
+			}
+		})
+	}
+}
+
+func TestRunInServices(t *testing.T) {
+	defer useTestProject(t, servicesWithScripts)()
+
+	o := &addRunOptions{allServices: true}
+	var out bytes.Buffer
+
+	if code := runInServices(&out, "test", o.selectServices(ioutil.Discard), []string{}, 2); code != 1 {
+		t.Errorf("expected a failing service to fail the run, got exit code %d", code)
+	}
+
+	output := out.String()
+
+	// the prefix is as wide as the longest service name, the last line of web has no newline
+	for _, line := range []string{
+		fmt.Sprintf("%-9s | api ok\n", "api"),
+		fmt.Sprintf("%-9s | admin broken\n", "api-admin"),
+		fmt.Sprintf("%-9s | web ok\n", "web"),
+	} {
+		if !strings.Contains(output, line) {
+			t.Errorf("expected the prefixed line %q in\n%s", line, output)
+		}
+	}
+
+	if strings.Contains(output, "\ndocs ") || strings.HasPrefix(output, "docs ") {
+		t.Errorf("expected docs to be skipped, got\n%s", output)
+	}
+
+	expected := map[string]string{"api": "SUCCESS", "api-admin": "FAILED", "docs": "SKIPPED", "web": "SUCCESS"}
+	for service, status := range expected {
+		found := false
+		for _, line := range strings.Split(output, "\n") {
+			fields := strings.Fields(strings.Replace(line, "|", " ", -1))
+			if len(fields) >= 2 && fields[0] == service && fields[1] == status {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected %s to be %s in the summary\n%s", service, status, output)
+		}
+	}
+
+	out.Reset()
+
+	if code := runInServices(&out, "test", o.selectServices(ioutil.Discard)[:1], []string{}, 1); code != 0 {
+		t.Errorf("expected the run of a passing service to succeed\n%s", out.String())
+	}
+}
+
+func TestRunInServicesWarnsOnContinueOnError(t *testing.T) {
+	defer useTestProject(t, map[string]string{
+		"kip_config.yaml":              "template: project\nenvironment: dev\nversion: v0.0.0\n",
+		"services/api/kip_config.yaml": "template: service\nversion: v0.0.0\nscripts:\n  - name: test\n    run: echo api ok\n",
+		"services/web/kip_config.yaml": "template: service\nversion: v0.0.0\nscripts:\n  - name: lint\n    continueOnError: true\n    run: exit 3\n  - name: test\n    steps: [lint]\n",
+	})()
+
+	o := &addRunOptions{allServices: true}
+	var out bytes.Buffer
+
+	if code := runInServices(&out, "test", o.selectServices(ioutil.Discard), []string{}, 1); code != exitCodeWarning {
+		t.Errorf("expected the warning exit code, got %d\n%s", code, out.String())
+	}
+
+	expected := map[string]string{"api": statusSuccess, "web": statusWarning}
+	for service, status := range expected {
+		found := false
+		for _, line := range strings.Split(out.String(), "\n") {
+			fields := strings.Fields(strings.Replace(line, "|", " ", -1))
+			if len(fields) >= 2 && fields[0] == service && fields[1] == status {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected %s to be %s in the summary\n%s", service, status, out.String())
+		}
+	}
+}
+
+func TestPrefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := &prefixWriter{mu: &sync.Mutex{}, out: &out, prefix: "api | "}
+
+	for _, chunk := range []string{"first\nsec", "ond\n", "", "third\nlast"} {
+		if n, err := w.Write([]byte(chunk)); err != nil || n != len(chunk) {
+			t.Fatalf("expected %d bytes to be written, got %d, %v", len(chunk), n, err)
+		}
+	}
+
+	if expected := "api | first\napi | second\napi | third\n"; out.String() != expected {
+		t.Errorf("expected only whole lines before the flush %q, got %q", expected, out.String())
+	}
+
+	w.Flush()
+
+	if expected := "api | first\napi | second\napi | third\napi | last\n"; out.String() != expected {
+		t.Errorf("expected the last line after the flush %q, got %q", expected, out.String())
+	}
+}
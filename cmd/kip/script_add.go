@@ -16,6 +16,7 @@ limitations under the License.
 package main
 
 import (
+	"debugged-dev/kip/v1/pkg/project"
 	"errors"
 	"fmt"
 	"io"
@@ -27,6 +28,7 @@ import (
 type addScriptOptions struct {
 	service string
 	command string
+	run     string
 	bindings []string
 }
 
@@ -53,7 +55,11 @@ func newAddScriptCmd(out io.Writer) *cobra.Command {
 				log.Fatalln("run this command inside a kip project")
 			}
 
-			scriptName := args[0]
+			if (o.command == "") == (o.run == "") {
+				log.Fatalln("set either --command or --run")
+			}
+
+			script := project.Script{Name: args[0], Command: o.command, Inline: o.run, Bindings: o.bindings}
 
 			var err error
 
@@ -64,13 +70,13 @@ func newAddScriptCmd(out io.Writer) *cobra.Command {
 					log.Fatal(err)
 				}
 
-				err = service.AddScript(scriptName, o.command, o.bindings)
+				err = service.AddScriptConfig(script)
 
 				if err != nil {
 					log.Fatal(err)
 				}
 			}else {
-				err = kipProject.AddScript(scriptName, o.command, o.bindings)
+				err = kipProject.AddScriptConfig(script)
 
 				if err != nil {
 					log.Fatal(err)
@@ -85,9 +91,8 @@ func newAddScriptCmd(out io.Writer) *cobra.Command {
 
 	f.StringVarP(&o.service, "service", "s", "", "service where to add script")
 	f.StringVarP(&o.command, "command", "c", "", "command to initiate script with, for example: bash, sh, node, python")
+	f.StringVar(&o.run, "run", "", "inline shell script, for example: \"npm ci && npm run migrate\"")
 	f.StringArrayVarP(&o.bindings, "bind", "b", []string{}, "script bindings, for example: pre-build, post-build, pre-deploy, post-deploy")
 
-	cmd.MarkFlagRequired("command")
-
 	return cmd
 }
@@ -16,7 +16,7 @@ limitations under the License.
 package main
 
 import (
-	"debugged-dev/kip/v1/internal/project"
+	"debugged-dev/kip/v1/pkg/project"
 	"fmt"
 	"io"
 	"os"
@@ -25,11 +25,30 @@ import (
 	"github.com/fatih/color"
 	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
-	"robpike.io/filter"
 )
 
 type listScriptOptions struct {
 	simple bool
+	output string
+}
+
+type scriptInfo struct {
+	Name            string   `json:"name" yaml:"name"`
+	Command         string   `json:"command" yaml:"command"`
+	Run             string   `json:"run,omitempty" yaml:"run,omitempty"`
+	Shell           string   `json:"shell,omitempty" yaml:"shell,omitempty"`
+	Workdir         string   `json:"workdir,omitempty" yaml:"workdir,omitempty"`
+	Needs           []string `json:"needs,omitempty" yaml:"needs,omitempty"`
+	Steps           []string `json:"steps,omitempty" yaml:"steps,omitempty"`
+	Timeout         string   `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Retries         int      `json:"retries,omitempty" yaml:"retries,omitempty"`
+	ContinueOnError bool     `json:"continueOnError,omitempty" yaml:"continueOnError,omitempty"`
+	Args            []string `json:"args" yaml:"args"`
+	Bindings        []string `json:"bindings" yaml:"bindings"`
+	Environments    []string `json:"environments" yaml:"environments"`
+	Path            string   `json:"path" yaml:"path"`
+	Owner           string   `json:"owner" yaml:"owner"`
+	Service         string   `json:"service,omitempty" yaml:"service,omitempty"`
 }
 
 func newListScriptCmd(out io.Writer) *cobra.Command {
@@ -50,30 +69,54 @@ func newListScriptCmd(out io.Writer) *cobra.Command {
 				os.Exit(1)
 			}
 
+			// --simple is kept for completion scripts generated by older versions
 			if o.simple {
-				scripts := kipProject.GetScripts("", "")
-				scriptNames := filter.Apply(scripts, func(s project.Script) string {
-					return s.Name
-				}).([]string)
-				fmt.Println(strings.Join(scriptNames[:], " "))
+				fmt.Fprintln(out, strings.Join(scriptNames(scriptInfos(projectScripts(out, kipProject, "", ""), "", "")), " "))
 				os.Exit(0)
 			}
 
-			switch kipProject.Template() {
-			case "project":
-				fmt.Printf("Scripts in project %s\n", kipProject.Name())
-				renderScriptsTable(kipProject.GetScripts("", ""))
+			if err := validateListFormat(o.output); err != nil {
+				fmt.Fprintln(out, color.RedString("%v", err))
+				os.Exit(1)
+			}
+
+			owner := kipProject.Template()
+			service := ""
+			if owner == "service" {
+				service = kipProject.Name()
+			}
 
-				for _, service := range kipProject.Services() {
-					fmt.Printf("\nScripts in service: %s\n", service.Name())
-					renderScriptsTable(service.GetScripts("", ""))
+			if o.output == formatTable {
+				switch kipProject.Template() {
+				case "project":
+					fmt.Fprintf(out, "Scripts in project %s\n", kipProject.Name())
+					renderScriptsTable(out, scriptInfos(projectScripts(out, kipProject, "", ""), owner, service))
+
+					for _, service := range projectServices(out, kipProject) {
+						fmt.Fprintf(out, "\nScripts in service: %s\n", service.Name())
+						renderScriptsTable(out, scriptInfos(projectScripts(out, service, "", ""), "service", service.Name()))
+					}
+				case "service":
+					fmt.Fprintf(out, "Scripts in service: %s\n", kipProject.Name())
+					renderScriptsTable(out, scriptInfos(projectScripts(out, kipProject, "", ""), owner, service))
 				}
+				return
+			}
+
+			scripts := scriptInfos(projectScripts(out, kipProject, "", ""), owner, service)
+
+			// the names are used for completion of kip run, which only runs scripts of the current project
+			names := scriptNames(scripts)
 
-				break
-			case "service":
-				fmt.Printf("Scripts in service: %s\n", kipProject.Name())
-				renderScriptsTable(kipProject.GetScripts("", ""))
-				break
+			if kipProject.Template() == "project" {
+				for _, service := range projectServices(out, kipProject) {
+					scripts = append(scripts, scriptInfos(projectScripts(out, service, "", ""), "service", service.Name())...)
+				}
+			}
+
+			if err := writeList(out, o.output, scripts, names); err != nil {
+				fmt.Fprintln(out, color.RedString("%v", err))
+				os.Exit(1)
 			}
 		},
 	}
@@ -81,22 +124,79 @@ func newListScriptCmd(out io.Writer) *cobra.Command {
 	f := cmd.Flags()
 	f.BoolVarP(&o.simple, "simple", "s", false, "print simple output")
 	f.MarkHidden("simple")
+	f.StringVarP(&o.output, "output", "o", formatTable, "output format: table, json, yaml or name")
 
 	return cmd
 }
 
-func renderScriptsTable(scripts []project.Script) {
-	data := [][]string{}
+func scriptInfos(scripts []project.Script, owner string, service string) []scriptInfo {
+	infos := []scriptInfo{}
 
 	for _, script := range scripts {
-		data = append(data, []string{script.Name, script.Command, strings.Join(script.Bindings, ","), script.Path})
+		info := scriptInfo{
+			Name:            script.Name,
+			Command:         script.Command,
+			Args:            nonNilStrings(script.Args),
+			Bindings:        nonNilStrings(script.Bindings),
+			Environments:    nonNilStrings(script.Environments),
+			Needs:           script.Needs,
+			Steps:           script.Steps,
+			Retries:         script.Retries,
+			ContinueOnError: script.ContinueOnError,
+			Path:            script.Path,
+			Owner:           owner,
+			Service:         service,
+		}
+
+		if script.Inline != "" {
+			info.Run = script.Inline
+			info.Shell = strings.Join(script.ShellCommand(), " ")
+		}
+
+		if script.Workdir != "" {
+			info.Workdir = script.Dir()
+		}
+
+		if script.Timeout > 0 {
+			info.Timeout = script.Timeout.String()
+		}
+
+		infos = append(infos, info)
 	}
 
-	table := tablewriter.NewWriter(color.Output)
-	table.SetHeader([]string{"name", "command", "binding", "path"})
+	return infos
+}
+
+func scriptNames(scripts []scriptInfo) []string {
+	names := []string{}
+	for _, script := range scripts {
+		names = append(names, script.Name)
+	}
+	return names
+}
 
-	for _, v := range data {
-		table.Append(v)
+// nonNilStrings makes sure empty lists are written as [] instead of null
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+func renderScriptsTable(out io.Writer, scripts []scriptInfo) {
+	table := tablewriter.NewWriter(out)
+	table.SetHeader([]string{"name", "command", "binding", "environments", "args", "path"})
+
+	for _, script := range scripts {
+		command := script.Command
+		if script.Run != "" {
+			// only the first line of inline scripts fits in the table
+			command = script.Shell + " " + strings.SplitN(strings.TrimSpace(script.Run), "\n", 2)[0]
+		} else if len(script.Steps) > 0 {
+			command = "steps: " + strings.Join(script.Steps, ", ")
+		}
+
+		table.Append([]string{script.Name, command, strings.Join(script.Bindings, ","), strings.Join(script.Environments, ","), strings.Join(script.Args, " "), script.Path})
 	}
 
 	table.Render()
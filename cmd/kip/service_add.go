@@ -21,7 +21,7 @@ import (
 	"io"
 	"os"
 
-	"debugged-dev/kip/v1/internal/project"
+	"debugged-dev/kip/v1/pkg/project"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
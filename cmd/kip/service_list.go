@@ -19,13 +19,29 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
+	"strings"
 
 	"github.com/fatih/color"
 	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
 )
 
+type listServiceOptions struct {
+	output string
+}
+
+type serviceInfo struct {
+	Name         string            `json:"name" yaml:"name"`
+	Path         string            `json:"path" yaml:"path"`
+	Dockerfile   bool              `json:"dockerfile" yaml:"dockerfile"`
+	Charts       []string          `json:"charts" yaml:"charts"`
+	Repositories map[string]string `json:"repositories" yaml:"repositories"`
+}
+
 func newListServiceCmd(out io.Writer) *cobra.Command {
+	o := &listServiceOptions{}
+
 	cmd := &cobra.Command{
 		Use:   "list",
 		Short: "lists all services",
@@ -41,26 +57,69 @@ func newListServiceCmd(out io.Writer) *cobra.Command {
 				os.Exit(1)
 			}
 
-			data := [][]string{}
+			if err := validateListFormat(o.output); err != nil {
+				fmt.Fprintln(out, color.RedString("%v", err))
+				os.Exit(1)
+			}
+
+			services := []serviceInfo{}
+			names := []string{}
 
-			for _, service := range kipProject.Services() {
-					if service.HasDockerfile() {
-						data = append(data, []string{service.Name(), "OK"})
-					}else {
-						data = append(data, []string{service.Name(), "Dockerfile not found"})
+			for _, service := range projectServices(out, kipProject) {
+				info := serviceInfo{
+					Name:         service.Name(),
+					Path:         service.Paths().Root,
+					Dockerfile:   service.HasDockerfile(kipProject.Environment()),
+					Charts:       []string{},
+					Repositories: map[string]string{},
+				}
+
+				for _, chart := range projectCharts(out, service) {
+					info.Charts = append(info.Charts, chart.Name())
+				}
+
+				for _, environment := range service.Environments() {
+					if repository, err := service.Repository(environment); err == nil {
+						info.Repositories[environment] = repository
 					}
+				}
+
+				services = append(services, info)
+				names = append(names, info.Name)
+			}
+
+			if o.output != formatTable {
+				if err := writeList(out, o.output, services, names); err != nil {
+					fmt.Fprintln(out, color.RedString("%v", err))
+					os.Exit(1)
+				}
+				return
 			}
 
-			table := tablewriter.NewWriter(color.Output)
-			table.SetHeader([]string{"services", "info"})
+			table := tablewriter.NewWriter(out)
+			table.SetHeader([]string{"services", "info", "charts", "repositories"})
+
+			for _, service := range services {
+				info := "OK"
+				if !service.Dockerfile {
+					info = "Dockerfile not found"
+				}
 
-			for _, v := range data {
-				table.Append(v)
+				repositories := []string{}
+				for environment, repository := range service.Repositories {
+					repositories = append(repositories, environment+": "+repository)
+				}
+				sort.Strings(repositories)
+
+				table.Append([]string{service.Name, info, strings.Join(service.Charts, ", "), strings.Join(repositories, ", ")})
 			}
 
 			table.Render()
 		},
 	}
 
+	f := cmd.Flags()
+	f.StringVarP(&o.output, "output", "o", formatTable, "output format: table, json, yaml or name")
+
 	return cmd
 }
@@ -7,9 +7,10 @@ require (
 	github.com/gammazero/workerpool v1.1.2
 	github.com/joho/godotenv v1.4.0
 	github.com/kyokomi/emoji v2.1.0+incompatible
+	github.com/mattn/go-isatty v0.0.14
 	github.com/olekukonko/tablewriter v0.0.4
-	github.com/schollz/progressbar/v3 v3.8.3
 	github.com/spf13/cobra v1.2.1
 	github.com/spf13/viper v1.9.0
+	gopkg.in/yaml.v2 v2.4.0
 	robpike.io/filter v0.0.0-20150108201509-2984852a2183
 )
@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
 	"os"
 	"os/exec"
 	"os/signal"
@@ -15,6 +14,9 @@ import (
 // DefaultGenerator for bla
 const DefaultGenerator = "empty"
 
+// ErrGeneratorNotFound is returned for generator names that do not exist
+var ErrGeneratorNotFound = errors.New("generator does not exist")
+
 type generator struct {
 	Name        string
 	Info        string
@@ -64,7 +66,7 @@ func Generate(generatorName string, path string, name string, args []string) err
 		buildErr = react(path, name, args)
 		break
 	default:
-		log.Fatalf("generator: \"%s\" does not exist\n", generatorName)
+		return fmt.Errorf("%w: %s", ErrGeneratorNotFound, generatorName)
 	}
 
 	if buildErr != nil {
@@ -101,7 +103,6 @@ RUN echo "hello world!"`
 func nestjs(path string, name string, args []string) error {
 	servicePath := filepath.Join(path, name)
 
-	requireCommand("npx")
 	cmdArgs := []string{"-p", "@nestjs/cli", "nest", "new", name, "--skip-git"}
 	cmdArgs = append(cmdArgs, args...)
 	err := runCommand(path, "npx", cmdArgs)
@@ -170,7 +171,6 @@ CMD [ "node", "dist/main.js" ]`
 func angular(path string, name string, args []string) error {
 	servicePath := filepath.Join(path, name)
 
-	requireCommand("npx")
 	cmdArgs := []string{"-p", "@angular/cli", "ng", "new", name, "--skipGit=true"}
 	err := runCommand(path, "npx", cmdArgs)
 
@@ -288,7 +288,9 @@ func signalWatcher(ctx context.Context, cmd *exec.Cmd) {
 }
 
 func runCommand(path string, command string, args []string) (err error) {
-	requireCommand(command)
+	if err := requireCommand(command); err != nil {
+		return err
+	}
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	cmd := exec.CommandContext(ctx, command, args...)
@@ -316,11 +318,11 @@ func runCommand(path string, command string, args []string) (err error) {
 	return nil
 }
 
-func requireCommand(command string) {
-	_, err := exec.LookPath(command)
-	if err != nil {
-		log.Fatalf("command \"%s\" not found in $PATH\n", command)
+func requireCommand(command string) error {
+	if _, err := exec.LookPath(command); err != nil {
+		return fmt.Errorf("command \"%s\" not found in $PATH", command)
 	}
+	return nil
 }
 
 func createDockerfile(servicePath string, dockerfile string) error {
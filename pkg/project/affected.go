@@ -0,0 +1,168 @@
+package project
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// changedFiles returns the absolute paths of all files in the git repository containing path
+// that differ from ref, including uncommitted and untracked files
+func changedFiles(runner Runner, path string, ref string) ([]string, error) {
+	root, err := gitOutput(runner, path, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+
+	diff, err := gitOutput(runner, path, "diff", "--name-only", ref, "--")
+	if err != nil {
+		return nil, err
+	}
+
+	untracked, err := gitOutput(runner, path, "ls-files", "--others", "--exclude-standard", "--full-name")
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+
+	for _, line := range strings.Split(diff+"\n"+untracked, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			files = append(files, filepath.Join(root, filepath.FromSlash(line)))
+		}
+	}
+
+	return files, nil
+}
+
+func gitOutput(runner Runner, path string, args ...string) (string, error) {
+	var stderr bytes.Buffer
+
+	stdout, err := output(runner, Command{Name: "git", Args: args, Dir: path, Stderr: &stderr})
+	if err != nil {
+		return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(string(stdout)), nil
+}
+
+// topLevelDirs returns the names of the directories directly below path that contain one of the files
+func topLevelDirs(path string, files []string) map[string]bool {
+	dirs := map[string]bool{}
+
+	path = resolvePath(path)
+
+	for _, file := range files {
+		rel, err := filepath.Rel(path, resolvePath(file))
+		if err != nil || rel == "." || isOutside(rel) {
+			continue
+		}
+
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if len(parts) > 1 {
+			dirs[parts[0]] = true
+		}
+	}
+
+	return dirs
+}
+
+// isOutside reports if a relative path leaves its base directory, ..config is a file inside it
+func isOutside(rel string) bool {
+	return rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolvePath resolves symlinks in the longest existing part of path, git reports real paths
+func resolvePath(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+
+	dir, file := filepath.Split(filepath.Clean(path))
+	if dir == "" || filepath.Clean(dir) == path {
+		return path
+	}
+
+	return filepath.Join(resolvePath(filepath.Clean(dir)), file)
+}
+
+// AffectedServices returns the services of the project with changes since the git ref.
+// Changes to a library count for every service that lists it under libraries
+func AffectedServices(p Project, ref string) ([]ServiceProject, error) {
+	files, err := changedFiles(p.commandRunner(), p.Paths().Root, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	projectServices, err := p.Services()
+	if err != nil {
+		return nil, err
+	}
+
+	services := []ServiceProject{}
+
+	if p.Template() == "service" {
+		if hasFileBelow(p.Paths().Root, files) {
+			services = append(services, projectServices...)
+		}
+		return services, nil
+	}
+
+	changedServices := topLevelDirs(p.Paths().Services, files)
+	changedLibraries := topLevelDirs(p.Paths().Libraries, files)
+
+	for _, service := range projectServices {
+		affected := changedServices[service.Name()]
+
+		for _, library := range service.Libraries() {
+			if changedLibraries[library] {
+				affected = true
+			}
+		}
+
+		if affected {
+			services = append(services, service)
+		}
+	}
+
+	return services, nil
+}
+
+// AffectedCharts returns the charts of the project with changes since the git ref
+func AffectedCharts(p Project, ref string) ([]Chart, error) {
+	files, err := changedFiles(p.commandRunner(), p.Paths().Root, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	projectCharts, err := p.Charts()
+	if err != nil {
+		return nil, err
+	}
+
+	changedCharts := topLevelDirs(p.Paths().Deployments, files)
+	charts := []Chart{}
+
+	for _, chart := range projectCharts {
+		if changedCharts[chart.Name()] {
+			charts = append(charts, chart)
+		}
+	}
+
+	return charts, nil
+}
+
+func hasFileBelow(path string, files []string) bool {
+	path = resolvePath(path)
+
+	for _, file := range files {
+		rel, err := filepath.Rel(path, resolvePath(file))
+		if err == nil && !isOutside(rel) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,89 @@
+package project
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTopLevelDirs(t *testing.T) {
+	root := filepath.Join(string(filepath.Separator), "repo", "shop", "services")
+
+	files := []string{
+		filepath.Join(root, "api", "main.go"),
+		filepath.Join(root, "..web", "main.go"),
+		filepath.Join(root, "README.md"),
+		filepath.Join(root, "..", "libraries", "common", "lib.go"),
+		filepath.Join(root, "..", "..", "other", "main.go"),
+	}
+
+	expected := map[string]bool{"api": true, "..web": true}
+	if dirs := topLevelDirs(root, files); !reflect.DeepEqual(dirs, expected) {
+		t.Errorf("expected %v, got %v", expected, dirs)
+	}
+
+	if !hasFileBelow(root, []string{filepath.Join(root, "..env")}) {
+		t.Error("expected ..env to be below the directory")
+	}
+	if hasFileBelow(root, []string{filepath.Join(root, "..", "env")}) {
+		t.Error("expected ../env not to be below the directory")
+	}
+}
+
+func TestAffectedServicesAndCharts(t *testing.T) {
+	runner := &FakeRunner{}
+	p, cleanup := newTestProject(t, map[string]string{
+		"kip_config.yaml":                "template: project\nenvironment: dev\nversion: v0.0.0\n",
+		"services/api/kip_config.yaml":   "template: service\nversion: v0.0.0\n",
+		"services/web/kip_config.yaml":   "template: service\nversion: v0.0.0\nlibraries: [common]\n",
+		"services/admin/kip_config.yaml": "template: service\nversion: v0.0.0\nlibraries: [auth]\n",
+		"services/docs/kip_config.yaml":  "template: service\nversion: v0.0.0\n",
+		"deployments/api/Chart.yaml":     "name: api\n",
+		"deployments/web/Chart.yaml":     "name: web\n",
+	}, runner)
+	defer cleanup()
+
+	// the git repository contains the project directory
+	gitRoot := filepath.Dir(p.Paths().Root)
+	runner.On("git rev-parse --show-toplevel", gitRoot+"\n", nil)
+	runner.On("git diff --name-only main --", "shop/services/api/main.go\nshop/libraries/common/lib.go\nshop/deployments/web/values.yaml\nREADME.md\n", nil)
+	runner.On("git ls-files --others --exclude-standard --full-name", "shop/services/docs/new.md\n", nil)
+
+	services, err := AffectedServices(p, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, service := range services {
+		names = append(names, service.Name())
+	}
+	if expected := []string{"api", "docs", "web"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected the affected services %v, got %v", expected, names)
+	}
+
+	charts, err := AffectedCharts(p, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names = []string{}
+	for _, chart := range charts {
+		names = append(names, chart.Name())
+	}
+	if expected := []string{"web"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected the affected charts %v, got %v", expected, names)
+	}
+
+	for _, call := range runner.Calls() {
+		if call.Name != "git" || call.Dir != p.Paths().Root {
+			t.Errorf("expected git to run in the project, got %s in %s", call, call.Dir)
+		}
+	}
+
+	runner.On("git diff --name-only unknown --", "", errors.New("exit status 128"))
+	if _, err := AffectedServices(p, "unknown"); err == nil {
+		t.Error("expected an unknown ref to fail")
+	}
+}
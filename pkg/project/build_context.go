@@ -0,0 +1,258 @@
+package project
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ignorePattern is a single line of a .dockerignore file
+type ignorePattern struct {
+	regexp    *regexp.Regexp
+	exclusion bool
+}
+
+// dockerIgnore matches paths the same way docker does when it sends the build context
+type dockerIgnore struct {
+	patterns []ignorePattern
+}
+
+func readDockerIgnore(path string) (*dockerIgnore, error) {
+	ignore := &dockerIgnore{}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return ignore, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		exclusion := false
+		if strings.HasPrefix(line, "!") {
+			exclusion = true
+			line = strings.TrimSpace(line[1:])
+		}
+
+		line = filepath.ToSlash(filepath.Clean(line))
+		line = strings.TrimPrefix(line, "/")
+
+		r, err := compileIgnorePattern(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern \"%s\" in %s: %v", line, path, err)
+		}
+
+		ignore.patterns = append(ignore.patterns, ignorePattern{regexp: r, exclusion: exclusion})
+	}
+
+	return ignore, scanner.Err()
+}
+
+func compileIgnorePattern(pattern string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+
+	for i := 0; i < len(pattern); i++ {
+		ch := pattern[i]
+
+		switch ch {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				// "**/" also matches zero directories
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+					sb.WriteString("(.*/)?")
+				} else {
+					sb.WriteString(".*")
+				}
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(string(pattern[i])))
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+
+	sb.WriteString("$")
+
+	return regexp.Compile(sb.String())
+}
+
+// Ignored reports if the slash separated path relative to the context root is excluded
+func (d *dockerIgnore) Ignored(path string) bool {
+	matched := false
+	parentDirs := strings.Split(filepath.Dir(path), "/")
+
+	for _, pattern := range d.patterns {
+		if pattern.exclusion != matched {
+			continue
+		}
+
+		match := pattern.regexp.MatchString(path)
+
+		// a pattern matching a parent directory excludes everything below it, like buildkit every parent
+		// is checked so **/node_modules also matches a/b/node_modules/index.js
+		for i := 0; !match && parentDirs[0] != "." && i < len(parentDirs); i++ {
+			match = pattern.regexp.MatchString(strings.Join(parentDirs[:i+1], "/"))
+		}
+
+		if match {
+			matched = !pattern.exclusion
+		}
+	}
+
+	return matched
+}
+
+// ContextHash returns a hash of everything docker receives when building the service:
+// the build context without ignored files, the Dockerfile and the build args of the environment
+func (s ServiceProject) ContextHash(args []string, environment string) (string, error) {
+	contextPath := s.BuildContext(environment)
+	dockerfilePath := s.Dockerfile(environment)
+
+	files, err := contextFiles(contextPath, dockerfilePath)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+
+	for _, file := range files {
+		if err := hashFile(h, contextPath, file); err != nil {
+			return "", err
+		}
+	}
+
+	// the Dockerfile is always sent, even when it is ignored or outside the context
+	dockerfile, err := os.Open(dockerfilePath)
+	if err != nil {
+		return "", err
+	}
+	defer dockerfile.Close()
+
+	fmt.Fprint(h, "\x00Dockerfile\x00")
+	if _, err := io.Copy(h, dockerfile); err != nil {
+		return "", err
+	}
+
+	fmt.Fprintf(h, "\x00args\x00%s", strings.Join(args, "\x00"))
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// contextFiles returns the sorted, slash separated paths docker sends as build context
+func contextFiles(contextPath string, dockerfilePath string) ([]string, error) {
+	// buildkit prefers a <Dockerfile>.dockerignore next to the Dockerfile
+	ignorePath := dockerfilePath + ".dockerignore"
+	if _, err := os.Stat(ignorePath); os.IsNotExist(err) {
+		ignorePath = filepath.Join(contextPath, ".dockerignore")
+	}
+
+	ignore, err := readDockerIgnore(ignorePath)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+
+	err = filepath.Walk(contextPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(contextPath, path)
+		if err != nil {
+			return err
+		}
+
+		if rel == "." {
+			return nil
+		}
+
+		rel = filepath.ToSlash(rel)
+
+		if ignore.Ignored(rel) {
+			// skip the whole directory unless an exclusion could bring files back
+			if info.IsDir() && !ignore.hasExclusions() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.Mode().IsRegular() || info.Mode()&os.ModeSymlink != 0 {
+			files = append(files, rel)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
+
+func (d *dockerIgnore) hasExclusions() bool {
+	for _, pattern := range d.patterns {
+		if pattern.exclusion {
+			return true
+		}
+	}
+	return false
+}
+
+func hashFile(w io.Writer, root string, file string) error {
+	path := filepath.Join(root, filepath.FromSlash(file))
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "%s\x00%o\x00", file, info.Mode().Perm())
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\x00", target)
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
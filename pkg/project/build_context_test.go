@@ -0,0 +1,231 @@
+package project
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCompileIgnorePattern(t *testing.T) {
+	tests := []struct {
+		pattern   string
+		matches   []string
+		unmatched []string
+	}{
+		{pattern: "*.log", matches: []string{"a.log", ".log"}, unmatched: []string{"logs/a.log", "a.logs"}},
+		{pattern: "logs/*.log", matches: []string{"logs/a.log"}, unmatched: []string{"logs/old/a.log", "a.log"}},
+		{pattern: "**/*.log", matches: []string{"a.log", "logs/a.log", "logs/old/a.log"}, unmatched: []string{"a.txt"}},
+		{pattern: "logs/**", matches: []string{"logs/a.log", "logs/old/a.log"}, unmatched: []string{"other/a.log"}},
+		{pattern: "a/**/b", matches: []string{"a/b", "a/x/b", "a/x/y/b"}, unmatched: []string{"a/xb"}},
+		{pattern: "file?.txt", matches: []string{"file1.txt"}, unmatched: []string{"file10.txt", "file/.txt"}},
+		{pattern: `\*.txt`, matches: []string{"*.txt"}, unmatched: []string{"a.txt"}},
+		{pattern: "a+b(c).txt", matches: []string{"a+b(c).txt"}, unmatched: []string{"aab(c).txt"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pattern, func(t *testing.T) {
+			r, err := compileIgnorePattern(test.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, path := range test.matches {
+				if !r.MatchString(path) {
+					t.Errorf("expected %s to match %s", test.pattern, path)
+				}
+			}
+			for _, path := range test.unmatched {
+				if r.MatchString(path) {
+					t.Errorf("expected %s not to match %s", test.pattern, path)
+				}
+			}
+		})
+	}
+}
+
+func writeDockerIgnore(t *testing.T, content string) *dockerIgnore {
+	dir, err := ioutil.TempDir("", "kip-dockerignore-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, ".dockerignore")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ignore, err := readDockerIgnore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ignore
+}
+
+func TestDockerIgnore(t *testing.T) {
+	tests := []struct {
+		name     string
+		ignore   string
+		ignored  []string
+		included []string
+	}{
+		{
+			name:     "no patterns",
+			ignore:   "# nothing ignored\n\n",
+			included: []string{"Dockerfile", "src/main.go"},
+		},
+		{
+			name:     "leading slash and cleaned paths",
+			ignore:   "/secret.txt\n./build/\n",
+			ignored:  []string{"secret.txt", "build/app"},
+			included: []string{"src/secret.txt", "builds/app"},
+		},
+		{
+			name:     "negation",
+			ignore:   "*.md\n!README.md\n",
+			ignored:  []string{"CHANGELOG.md"},
+			included: []string{"README.md", "docs/guide.md"},
+		},
+		{
+			name:     "later patterns win",
+			ignore:   "*.md\n!*.md\nCHANGELOG.md\n",
+			ignored:  []string{"CHANGELOG.md"},
+			included: []string{"README.md"},
+		},
+		{
+			name:     "double star",
+			ignore:   "**/*.log\n",
+			ignored:  []string{"a.log", "logs/a.log", "logs/old/a.log"},
+			included: []string{"a.txt", "logs/a.txt"},
+		},
+		{
+			name:     "parent directory",
+			ignore:   "node_modules\nlogs/old\n",
+			ignored:  []string{"node_modules/index.js", "node_modules/lib/a.js", "logs/old/a.log"},
+			included: []string{"web/node_modules/index.js", "logs/a.log"},
+		},
+		{
+			name:     "double star parent directory",
+			ignore:   "**/node_modules\n",
+			ignored:  []string{"node_modules/index.js", "web/node_modules/index.js", "a/b/node_modules/lib/a.js"},
+			included: []string{"web/src/index.js"},
+		},
+		{
+			name:     "directory excluded with a file re-included",
+			ignore:   "docs\n!docs/README.md\n",
+			ignored:  []string{"docs", "docs/guide.md", "docs/images/logo.png"},
+			included: []string{"docs/README.md", "README.md"},
+		},
+		{
+			name:     "negation without an earlier match",
+			ignore:   "!README.md\n",
+			included: []string{"README.md", "main.go"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ignore := writeDockerIgnore(t, test.ignore)
+
+			for _, path := range test.ignored {
+				if !ignore.Ignored(path) {
+					t.Errorf("expected %s to be ignored", path)
+				}
+			}
+			for _, path := range test.included {
+				if ignore.Ignored(path) {
+					t.Errorf("expected %s to be included", path)
+				}
+			}
+		})
+	}
+}
+
+func TestContextFiles(t *testing.T) {
+	files := []string{
+		"Dockerfile",
+		"README.md",
+		"main.go",
+		"secret.txt",
+		"docs/README.md",
+		"docs/guide.md",
+		"docs/images/logo.png",
+		"node_modules/lib/index.js",
+		"web/node_modules/index.js",
+		"web/app.js",
+	}
+
+	tests := []struct {
+		name       string
+		ignore     string
+		dockerfile string
+		expected   []string
+	}{
+		{
+			name:     "without a .dockerignore",
+			expected: []string{"Dockerfile", "README.md", "docs/README.md", "docs/guide.md", "docs/images/logo.png", "main.go", "node_modules/lib/index.js", "secret.txt", "web/app.js", "web/node_modules/index.js"},
+		},
+		{
+			name:     "ignored files and directories",
+			ignore:   "secret.txt\n**/node_modules\ndocs\n",
+			expected: []string{"Dockerfile", "README.md", "main.go", "web/app.js"},
+		},
+		{
+			name:     "directory excluded with a file re-included",
+			ignore:   "docs\n!docs/README.md\n*.md\n!README.md\n",
+			expected: []string{"Dockerfile", "README.md", "docs/README.md", "main.go", "node_modules/lib/index.js", "secret.txt", "web/app.js", "web/node_modules/index.js"},
+		},
+		{
+			name:       "the .dockerignore next to the Dockerfile is preferred",
+			ignore:     "docs\n",
+			dockerfile: "*\n!Dockerfile\n!main.go\n",
+			expected:   []string{"Dockerfile", "main.go"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "kip-context-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			for _, file := range files {
+				path := filepath.Join(dir, filepath.FromSlash(file))
+				if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(path, []byte(file), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			expected := test.expected
+			if test.ignore != "" {
+				if err := ioutil.WriteFile(filepath.Join(dir, ".dockerignore"), []byte(test.ignore), 0644); err != nil {
+					t.Fatal(err)
+				}
+				if test.dockerfile == "" {
+					expected = append([]string{".dockerignore"}, expected...)
+				}
+			}
+			if test.dockerfile != "" {
+				if err := ioutil.WriteFile(filepath.Join(dir, "Dockerfile.dockerignore"), []byte(test.dockerfile), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			contextFiles, err := contextFiles(dir, filepath.Join(dir, "Dockerfile"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(contextFiles, expected) {
+				t.Errorf("expected %v, got %v", expected, contextFiles)
+			}
+		})
+	}
+}
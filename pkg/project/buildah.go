@@ -0,0 +1,71 @@
+package project
+
+import (
+	"os"
+)
+
+// buildah builds and pushes images without a daemon
+type buildah struct {
+	runner  Runner
+	dir     string
+	digests digestStore
+}
+
+func (b buildah) Build(build ImageBuild) ([]byte, error) {
+	cacheArgs, err := registryCacheArgs(BuilderBuildah, build.Cache)
+	if err != nil {
+		return nil, err
+	}
+
+	cmdArgs := []string{"bud", "-f", build.Dockerfile}
+	for _, tag := range build.Tags {
+		cmdArgs = append(cmdArgs, "-t", tag)
+	}
+	if len(cacheArgs) > 0 {
+		// buildah only caches with layers enabled
+		cmdArgs = append(cmdArgs, "--layers")
+		cmdArgs = append(cmdArgs, cacheArgs...)
+	}
+	cmdArgs = append(cmdArgs, build.Args...)
+	cmdArgs = append(cmdArgs, build.Context)
+	return streamOutput(b.runner, Command{Name: "buildah", Args: cmdArgs, Dir: build.Context}, build.Output)
+}
+
+func (b buildah) ImageID(image string) (string, error) {
+	out, err := output(b.runner, Command{Name: "buildah", Args: []string{"inspect", "--type", "image", "--format", "{{.FromImageID}}", image}, Dir: b.dir})
+	if err != nil {
+		return "", err
+	}
+	return normalizeImageID(string(out)), nil
+}
+
+func (b buildah) RepoDigests(image string) ([]string, error) {
+	return b.digests.repoDigests(image)
+}
+
+func (b buildah) Tag(source string, target string) error {
+	_, err := combinedOutput(b.runner, Command{Name: "buildah", Args: []string{"tag", source, target}, Dir: b.dir})
+	return err
+}
+
+func (b buildah) Push(image string, args []string) ([]byte, error) {
+	digestFile, err := tempDigestFile()
+	if err != nil {
+		return nil, err
+	}
+
+	cmdArgs := append([]string{"push", "--digestfile", digestFile}, args...)
+	cmdArgs = append(cmdArgs, image, "docker://"+image)
+	out, err := combinedOutput(b.runner, Command{Name: "buildah", Args: cmdArgs, Dir: b.dir})
+	if err != nil {
+		os.Remove(digestFile)
+		return out, err
+	}
+
+	digest, err := readDigestFile(digestFile)
+	if err != nil {
+		return out, err
+	}
+
+	return out, b.digests.save(digest, image)
+}
@@ -0,0 +1,220 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	// BuilderDocker builds with the docker CLI or the Docker Engine API
+	BuilderDocker = "docker"
+	// BuilderBuildah builds with buildah, no daemon needed
+	BuilderBuildah = "buildah"
+	// BuilderPodman builds with podman, no daemon needed
+	BuilderPodman = "podman"
+	// BuilderKaniko builds and pushes with the kaniko executor, meant for in-cluster CI
+	BuilderKaniko = "kaniko"
+)
+
+// Builders lists the supported image builders
+var Builders = []string{BuilderDocker, BuilderBuildah, BuilderPodman, BuilderKaniko}
+
+// ImageBuild describes an image build
+type ImageBuild struct {
+	// Context is the directory sent as build context
+	Context string
+	// Dockerfile is the path of the Dockerfile relative to the context
+	Dockerfile string
+	Tags       []string
+	// Platforms are the platforms of a multi-platform build, empty for the local platform
+	Platforms []string
+	// Cache are the buildkit cache imports and exports
+	Cache BuildCache
+	// Args are extra docker build arguments like --build-arg or --target
+	Args []string
+	// Output receives the build output while it is written, Build returns no output then
+	Output io.Writer
+}
+
+// Builder builds, inspects, tags and pushes images
+type Builder interface {
+	Build(build ImageBuild) ([]byte, error)
+	ImageID(image string) (string, error)
+	RepoDigests(image string) ([]string, error)
+	Tag(source string, target string) error
+	Push(image string, args []string) ([]byte, error)
+}
+
+// BuilderCommand returns the binary the builder runs
+func BuilderCommand(builder string) string {
+	if builder == BuilderKaniko {
+		return "executor"
+	}
+	return builder
+}
+
+// BuilderName returns the image builder of the service in the environment, docker by default
+func (s ServiceProject) BuilderName(environment string) string {
+	configs := s.EnvConfig()
+	if val, ok := configs[environment]; ok && val.Builder != "" {
+		return val.Builder
+	}
+
+	if s.config.IsSet("builder") {
+		return s.config.GetString("builder")
+	}
+
+	if s.project != nil {
+		return s.project.BuilderName(environment)
+	}
+
+	return BuilderDocker
+}
+
+// pushesWhileBuilding reports if the builder pushes while building and can not tag images in the registry
+// afterwards. The key is pushed as tag while building and the image has no image ID tag
+func (s ServiceProject) pushesWhileBuilding(environment string) bool {
+	return s.BuilderName(environment) == BuilderKaniko
+}
+
+// builder returns the image builder of the service in the environment
+func (s ServiceProject) builder(environment string) (Builder, error) {
+	digests := digestStore{path: filepath.Join(s.rootPath(), ".kip", "digests.json")}
+
+	builder := s.BuilderName(environment)
+
+	if len(s.Platforms(environment)) > 0 {
+		if builder != BuilderDocker || s.DockerBackend() != DockerBackendCLI {
+			return nil, fmt.Errorf("platforms are only supported by the docker builder with the %s backend", DockerBackendCLI)
+		}
+		return buildx{runner: s.commandRunner(), dir: s.Paths().Root}, nil
+	}
+
+	switch builder {
+	case BuilderDocker:
+		return s.docker()
+	case BuilderPodman:
+		return podman{dockerCLI: dockerCLI{name: "podman", runner: s.commandRunner(), dir: s.Paths().Root}, digests: digests}, nil
+	case BuilderBuildah:
+		return buildah{runner: s.commandRunner(), dir: s.Paths().Root, digests: digests}, nil
+	case BuilderKaniko:
+		return kaniko{runner: s.commandRunner(), digests: digests}, nil
+	default:
+		return nil, fmt.Errorf("builder \"%s\" not supported, use one of %s", builder, strings.Join(Builders, ", "))
+	}
+}
+
+// normalizeImageID adds the sha256 prefix podman and buildah leave out
+func normalizeImageID(id string) string {
+	id = strings.TrimSpace(id)
+	if id != "" && !strings.HasPrefix(id, "sha256:") {
+		return "sha256:" + id
+	}
+	return id
+}
+
+var digestsMutex sync.Mutex
+
+// digestStore remembers the registry digests of images pushed by builders without a local image store
+type digestStore struct {
+	path string
+}
+
+func (d digestStore) read() (map[string]string, error) {
+	digests := map[string]string{}
+
+	content, err := ioutil.ReadFile(d.path)
+	if os.IsNotExist(err) {
+		return digests, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, &digests); err != nil {
+		return nil, fmt.Errorf("unable to read %s: %v", d.path, err)
+	}
+
+	return digests, nil
+}
+
+func (d digestStore) get(image string) (string, bool) {
+	digestsMutex.Lock()
+	defer digestsMutex.Unlock()
+
+	digests, err := d.read()
+	if err != nil {
+		return "", false
+	}
+
+	digest, ok := digests[image]
+	return digest, ok
+}
+
+func (d digestStore) save(digest string, images ...string) error {
+	digestsMutex.Lock()
+	defer digestsMutex.Unlock()
+
+	digests, err := d.read()
+	if err != nil {
+		return err
+	}
+
+	for _, image := range images {
+		digests[image] = digest
+	}
+
+	content, err := json.MarshalIndent(digests, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(d.path), os.ModePerm); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(d.path, content, 0644)
+}
+
+// repoDigests returns the pushed image as repository@digest
+func (d digestStore) repoDigests(image string) ([]string, error) {
+	digest, ok := d.get(image)
+	if !ok {
+		return []string{}, nil
+	}
+
+	repository, _ := splitImageTag(image)
+	return []string{repository + "@" + digest}, nil
+}
+
+// readDigestFile reads the digest a builder wrote with --digestfile or --digest-file and removes the file
+func readDigestFile(path string) (string, error) {
+	defer os.Remove(path)
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	digest := strings.TrimSpace(string(content))
+	if digest == "" {
+		return "", fmt.Errorf("no digest was written to %s", path)
+	}
+
+	return digest, nil
+}
+
+// tempDigestFile returns the path of a new temporary file builders write the pushed digest to
+func tempDigestFile() (string, error) {
+	f, err := ioutil.TempFile("", "kip-digest-")
+	if err != nil {
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
@@ -0,0 +1,236 @@
+package project
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// digestRunner writes the test digest to the digest files builders pass to their push commands
+type digestRunner struct {
+	*FakeRunner
+}
+
+func (d digestRunner) Run(cmd Command) error {
+	err := d.FakeRunner.Run(cmd)
+
+	for i, arg := range cmd.Args {
+		if (arg == "--digestfile" || arg == "--digest-file") && i+1 < len(cmd.Args) && err == nil {
+			if writeErr := ioutil.WriteFile(cmd.Args[i+1], []byte(testDigest+"\n"), 0644); writeErr != nil {
+				return writeErr
+			}
+		}
+	}
+
+	return err
+}
+
+func TestBuilders(t *testing.T) {
+	inspect := map[string][]string{
+		"buildah": {"buildah", "inspect", "--type", "image", "--format", "{{.FromImageID}}"},
+		"podman":  {"podman", "inspect", "--format", "{{.Id}}"},
+		"buildx":  {"docker", "buildx", "imagetools", "inspect"},
+	}
+
+	tests := []struct {
+		name     string
+		builder  string
+		config   string
+		imageID  string
+		expected func(root string, hash string) [][]string
+	}{
+		{
+			name:    "buildah",
+			builder: "buildah",
+			config:  "builder: buildah",
+			imageID: testImageID,
+			expected: func(root string, hash string) [][]string {
+				return [][]string{
+					append(inspect["buildah"], "registry.local/api:kip-"+hash),
+					{"buildah", "bud", "-f", "Dockerfile", "-t", "registry.local/api:temp-latest", "-t", "registry.local/api:kip-" + hash, "--build-arg", "VERSION=1", root},
+					append(inspect["buildah"], "registry.local/api:temp-latest"),
+					{"buildah", "tag", "registry.local/api:temp-latest", "registry.local/api:0123456789ab"},
+					{"buildah", "tag", "registry.local/api:temp-latest", "registry.local/api:latest"},
+					append(inspect["buildah"], "registry.local/api:latest"),
+					{"buildah", "push", "--digestfile", "<digestfile>", "registry.local/api:0123456789ab", "docker://registry.local/api:0123456789ab"},
+					append(inspect["buildah"], "registry.local/api:latest"),
+				}
+			},
+		},
+		{
+			name:    "podman",
+			builder: "podman",
+			config:  "builder: podman",
+			imageID: testImageID,
+			expected: func(root string, hash string) [][]string {
+				return [][]string{
+					append(inspect["podman"], "registry.local/api:kip-"+hash),
+					{"podman", "build", root, "-f", "Dockerfile", "-t", "registry.local/api:temp-latest", "-t", "registry.local/api:kip-" + hash, "--build-arg", "VERSION=1"},
+					append(inspect["podman"], "registry.local/api:temp-latest"),
+					{"podman", "tag", "registry.local/api:temp-latest", "registry.local/api:0123456789ab"},
+					{"podman", "tag", "registry.local/api:temp-latest", "registry.local/api:latest"},
+					append(inspect["podman"], "registry.local/api:latest"),
+					{"podman", "push", "--digestfile", "<digestfile>", "registry.local/api:0123456789ab"},
+					append(inspect["podman"], "registry.local/api:latest"),
+				}
+			},
+		},
+		{
+			name:    "kaniko",
+			builder: "kaniko",
+			config:  "builder: kaniko",
+			imageID: testDigest,
+			expected: func(root string, hash string) [][]string {
+				return [][]string{
+					{"executor", "--context", root, "--dockerfile", filepath.Join(root, "Dockerfile"), "--digest-file", "<digestfile>", "--destination", "registry.local/api:temp-latest", "--destination", "registry.local/api:kip-" + hash, "--destination", "registry.local/api:latest", "--build-arg", "VERSION=1"},
+				}
+			},
+		},
+		{
+			name:    "buildx",
+			builder: "docker",
+			config:  "platforms: [linux/amd64, linux/arm64]",
+			imageID: testDigest,
+			expected: func(root string, hash string) [][]string {
+				return [][]string{
+					append(inspect["buildx"], "registry.local/api:kip-"+hash, "--format", "{{.Manifest.Digest}}"),
+					{"docker", "buildx", "build", root, "-f", "Dockerfile", "--platform", "linux/amd64,linux/arm64", "-t", "registry.local/api:temp-latest", "-t", "registry.local/api:kip-" + hash, "--push", "--build-arg", "VERSION=1"},
+					append(inspect["buildx"], "registry.local/api:temp-latest", "--format", "{{.Manifest.Digest}}"),
+					{"docker", "buildx", "imagetools", "create", "--tag", "registry.local/api:fedcba987654", "registry.local/api:temp-latest"},
+					{"docker", "buildx", "imagetools", "create", "--tag", "registry.local/api:latest", "registry.local/api:temp-latest"},
+					append(inspect["buildx"], "registry.local/api:latest", "--format", "{{.Manifest.Digest}}"),
+					append(inspect["buildx"], "registry.local/api:latest", "--format", "{{.Manifest.Digest}}"),
+					append(inspect["buildx"], "registry.local/api:fedcba987654", "--format", "{{.Manifest.Digest}}"),
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			runner := &FakeRunner{}
+			p, cleanup := newTestProject(t, map[string]string{
+				"kip_config.yaml": `template: project
+environment: dev
+version: v0.0.0
+environments:
+  dev:
+    repository: registry.local/
+    ` + test.config + `
+`,
+				"services/api/kip_config.yaml": "template: service\nversion: v0.0.0\n",
+				"services/api/Dockerfile":      "FROM scratch\n",
+			}, digestRunner{runner})
+			defer cleanup()
+
+			service := testService(t, p, "api")
+			args := []string{"--build-arg", "VERSION=1"}
+			hashArgs := args
+
+			if builder := service.BuilderName("dev"); builder != test.builder {
+				t.Fatalf("expected the builder %s of the environment, got %s", test.builder, builder)
+			}
+
+			if platforms := service.Platforms("dev"); len(platforms) > 0 {
+				hashArgs = append(args, "--platform", strings.Join(platforms, ","))
+			}
+
+			hash, err := service.ContextHash(hashArgs, "dev")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// podman and buildah print the image ID without the sha256 prefix, buildx the manifest list digest
+			if inspectArgs, ok := inspect[test.name]; ok {
+				prefix := strings.Join(inspectArgs, " ")
+				id := test.imageID
+				if test.name != "buildx" {
+					id = strings.TrimPrefix(id, "sha256:")
+				}
+				runner.On(prefix, id+"\n", nil)
+				runner.On(prefix+" registry.local/api:kip-", "", errors.New("no such image"))
+			}
+
+			if _, _, err := service.Build("", "latest", args, "dev", false); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := service.Push("", "latest", []string{}, "dev"); err != nil {
+				t.Fatal(err)
+			}
+
+			calls := [][]string{}
+			for _, call := range runner.Calls() {
+				args := append([]string{call.Name}, call.Args...)
+				for i := range args {
+					if i > 0 && (args[i-1] == "--digestfile" || args[i-1] == "--digest-file") {
+						args[i] = "<digestfile>"
+					}
+				}
+				calls = append(calls, args)
+			}
+
+			if expected := test.expected(service.Paths().Root, hash); !reflect.DeepEqual(calls, expected) {
+				t.Errorf("expected the commands\n%v\ngot\n%v", expected, calls)
+			}
+
+			record, found := loadImageRecord(p.Paths().Root, "dev", "api", "latest")
+			if !found {
+				t.Fatal("expected an image record")
+			}
+
+			if record.Digest != testDigest || record.ImageID != test.imageID {
+				t.Errorf("unexpected image record %+v", record)
+			}
+
+			// kaniko can not tag in the registry after the build, the key is the only pushed tag
+			if test.builder == "kaniko" && record.Tag != "latest" {
+				t.Errorf("expected the key as tag of the kaniko image, got %+v", record)
+			}
+		})
+	}
+}
+
+func TestKanikoSkipsOnlyWhenTheKeyIsPushed(t *testing.T) {
+	runner := &FakeRunner{}
+	p, cleanup := newTestProject(t, map[string]string{
+		"kip_config.yaml": `template: project
+environment: dev
+version: v0.0.0
+builder: kaniko
+environments:
+  dev:
+    repository: registry.local/
+`,
+		"services/api/kip_config.yaml": "template: service\nversion: v0.0.0\n",
+		"services/api/Dockerfile":      "FROM scratch\n",
+	}, digestRunner{runner})
+	defer cleanup()
+
+	service := testService(t, p, "api")
+
+	for _, test := range []struct {
+		key     string
+		skipped bool
+	}{
+		{key: "latest", skipped: false},
+		{key: "latest", skipped: true},
+		{key: "v2", skipped: false},
+	} {
+		_, skipped, err := service.Build("", test.key, []string{}, "dev", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if skipped != test.skipped {
+			t.Errorf("expected the build of %s to be skipped: %v, got %v", test.key, test.skipped, skipped)
+		}
+	}
+
+	if calls := runner.Calls(); len(calls) != 2 || !strings.Contains(calls[1].String(), "--destination registry.local/api:v2") {
+		t.Errorf("expected the new key to be pushed by a second build, got %v", calls)
+	}
+}
@@ -0,0 +1,57 @@
+package project
+
+import (
+	"fmt"
+	"strings"
+)
+
+// buildx builds multi-platform images. The docker image store can not hold manifest lists, so the
+// manifest list is pushed while building and tags and image IDs are resolved in the registry
+type buildx struct {
+	runner Runner
+	dir    string
+}
+
+func (b buildx) Build(build ImageBuild) ([]byte, error) {
+	cmdArgs := []string{"buildx", "build", build.Context, "-f", build.Dockerfile, "--platform", strings.Join(build.Platforms, ",")}
+	for _, tag := range build.Tags {
+		cmdArgs = append(cmdArgs, "-t", tag)
+	}
+	cacheArgs, err := buildkitCacheArgs(build.Cache, true)
+	if err != nil {
+		return nil, err
+	}
+	cmdArgs = append(cmdArgs, cacheArgs...)
+	cmdArgs = append(cmdArgs, "--push")
+	cmdArgs = append(cmdArgs, build.Args...)
+	return streamOutput(b.runner, Command{Name: "docker", Args: cmdArgs, Dir: build.Context}, build.Output)
+}
+
+// ImageID returns the digest of the manifest list, it identifies the image for all platforms
+func (b buildx) ImageID(image string) (string, error) {
+	out, err := output(b.runner, Command{Name: "docker", Args: []string{"buildx", "imagetools", "inspect", image, "--format", "{{.Manifest.Digest}}"}, Dir: b.dir})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (b buildx) RepoDigests(image string) ([]string, error) {
+	digest, err := b.ImageID(image)
+	if err != nil {
+		return nil, err
+	}
+
+	repository, _ := splitImageTag(image)
+	return []string{repository + "@" + digest}, nil
+}
+
+// Tag tags the manifest list in the registry without pulling it
+func (b buildx) Tag(source string, target string) error {
+	_, err := combinedOutput(b.runner, Command{Name: "docker", Args: []string{"buildx", "imagetools", "create", "--tag", target, source}, Dir: b.dir})
+	return err
+}
+
+func (b buildx) Push(image string, args []string) ([]byte, error) {
+	return []byte(fmt.Sprintf("manifest list %s was pushed by buildx while building\n", image)), nil
+}
@@ -0,0 +1,206 @@
+package project
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// cacheConfig is the cache section of a kip_config. Entries are buildkit cache specs like
+// type=registry,ref=<repository><service>:buildcache, a plain image ref, or the shorthands
+// registry, local and inline
+type cacheConfig struct {
+	From []string `mapstructure:"from"`
+	To   []string `mapstructure:"to"`
+}
+
+func (c *cacheConfig) isSet() bool {
+	return c != nil && (len(c.From) > 0 || len(c.To) > 0)
+}
+
+// BuildCache contains the resolved buildkit cache specs of a build
+type BuildCache struct {
+	From []string
+	To   []string
+}
+
+// cacheSpec is a parsed buildkit cache spec
+type cacheSpec struct {
+	Type  string
+	Attrs map[string]string
+}
+
+func parseCacheSpec(spec string) cacheSpec {
+	parsed := cacheSpec{Attrs: map[string]string{}}
+
+	for _, field := range strings.Split(spec, ",") {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if parts[0] == "type" {
+			parsed.Type = parts[1]
+		} else {
+			parsed.Attrs[parts[0]] = parts[1]
+		}
+	}
+
+	return parsed
+}
+
+// Cache returns the build cache of the service in the environment with the placeholders
+// <repository>, <service> and <projectDir> filled in
+func (s ServiceProject) Cache(repository string, environment string) BuildCache {
+	config := s.cacheConfig(environment)
+	if config == nil {
+		return BuildCache{}
+	}
+
+	localDir := filepath.Join(s.rootPath(), ".kip", "cache", s.Name())
+
+	resolve := func(entries []string, export bool) []string {
+		specs := []string{}
+		for _, entry := range entries {
+			switch entry {
+			case "registry":
+				entry = "type=registry,ref=<repository><service>:buildcache"
+				if export {
+					entry += ",mode=max"
+				}
+			case "local":
+				if export {
+					entry = "type=local,dest=" + localDir + ",mode=max"
+				} else {
+					entry = "type=local,src=" + localDir
+				}
+			case "inline":
+				entry = "type=inline"
+			}
+
+			if !strings.Contains(entry, "type=") {
+				entry = "type=registry,ref=" + entry
+			}
+
+			entry = strings.ReplaceAll(entry, "<repository>", repository)
+			entry = strings.ReplaceAll(entry, "<service>", s.Name())
+			entry = strings.ReplaceAll(entry, "<projectDir>", s.rootPath())
+			specs = append(specs, s.formatString(entry))
+		}
+		return specs
+	}
+
+	return BuildCache{From: resolve(config.From, false), To: resolve(config.To, true)}
+}
+
+func (s ServiceProject) cacheConfig(environment string) *cacheConfig {
+	configs := s.EnvConfig()
+	if val, ok := configs[environment]; ok && val.Cache.isSet() {
+		return val.Cache
+	}
+
+	if s.config.IsSet("cache") {
+		config := &cacheConfig{}
+		if err := s.config.UnmarshalKey("cache", config); err == nil {
+			return config
+		}
+	}
+
+	if s.project != nil {
+		return s.project.cacheConfig(environment)
+	}
+
+	return nil
+}
+
+func (p MonoProject) cacheConfig(environment string) *cacheConfig {
+	configs := p.EnvConfig()
+	if val, ok := configs[environment]; ok && val.Cache.isSet() {
+		return val.Cache
+	}
+
+	if p.config.IsSet("cache") {
+		config := &cacheConfig{}
+		if err := p.config.UnmarshalKey("cache", config); err == nil {
+			return config
+		}
+	}
+
+	return nil
+}
+
+// buildkitCacheArgs returns the cache as --cache-from and --cache-to. Without buildx registry caches
+// are imported by their ref and only the inline cache can be exported, with the BUILDKIT_INLINE_CACHE build arg
+func buildkitCacheArgs(cache BuildCache, buildx bool) ([]string, error) {
+	args := []string{}
+
+	for _, spec := range cache.From {
+		if parsed := parseCacheSpec(spec); !buildx && parsed.Type == "registry" && parsed.Attrs["ref"] != "" {
+			spec = parsed.Attrs["ref"]
+		}
+		args = append(args, "--cache-from", spec)
+	}
+
+	for _, spec := range cache.To {
+		if !buildx {
+			// the docker driver of the default builder rejects every other --cache-to
+			if parseCacheSpec(spec).Type != "inline" {
+				return nil, fmt.Errorf("the docker builder only exports the inline cache, got \"%s\", set platforms to build with buildx", spec)
+			}
+			args = append(args, "--build-arg", "BUILDKIT_INLINE_CACHE=1")
+			continue
+		}
+		args = append(args, "--cache-to", spec)
+	}
+
+	return args, nil
+}
+
+// registryCacheArgs returns the cache refs for builders that only cache in registries, like podman and buildah
+func registryCacheArgs(builder string, cache BuildCache) ([]string, error) {
+	args := []string{}
+
+	flags := []struct {
+		name  string
+		specs []string
+	}{
+		{name: "--cache-from", specs: cache.From},
+		{name: "--cache-to", specs: cache.To},
+	}
+
+	for _, flag := range flags {
+		for _, spec := range flag.specs {
+			ref, err := registryCacheRef(builder, spec)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, flag.name, ref)
+		}
+	}
+
+	return args, nil
+}
+
+func registryCacheRef(builder string, spec string) (string, error) {
+	parsed := parseCacheSpec(spec)
+	if parsed.Type != "registry" || parsed.Attrs["ref"] == "" {
+		return "", fmt.Errorf("%s only supports registry caches, got \"%s\"", builder, spec)
+	}
+	return parsed.Attrs["ref"], nil
+}
+
+// cacheRepository returns the repository kaniko caches layers in, exports are preferred over imports
+func cacheRepository(cache BuildCache) (string, error) {
+	specs := append(append([]string{}, cache.To...), cache.From...)
+	if len(specs) == 0 {
+		return "", nil
+	}
+
+	ref, err := registryCacheRef(BuilderKaniko, specs[0])
+	if err != nil {
+		return "", err
+	}
+
+	// kaniko stores the layers as tags of the repository
+	repository, _ := splitImageTag(ref)
+	return repository, nil
+}
@@ -0,0 +1,100 @@
+package project
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCache(t *testing.T) {
+	runner := &FakeRunner{}
+	p, cleanup := newTestProject(t, map[string]string{
+		"kip_config.yaml": `template: project
+environment: dev
+version: v0.0.0
+cache:
+  from: [registry]
+  to: [inline]
+environments:
+  dev:
+    repository: registry.local/
+  ci:
+    repository: registry.ci/
+    cache:
+      from: [local, "<repository>base:buildcache"]
+      to: [registry]
+`,
+		"services/api/kip_config.yaml": "template: service\nversion: v0.0.0\n",
+		"services/api/Dockerfile":      "FROM scratch\n",
+	}, runner)
+	defer cleanup()
+
+	service := testService(t, p, "api")
+	localDir := filepath.Join(p.Paths().Root, ".kip", "cache", "api")
+
+	tests := []struct {
+		environment string
+		repository  string
+		expected    BuildCache
+	}{
+		{
+			environment: "dev",
+			repository:  "registry.local/",
+			expected: BuildCache{
+				From: []string{"type=registry,ref=registry.local/api:buildcache"},
+				To:   []string{"type=inline"},
+			},
+		},
+		{
+			environment: "ci",
+			repository:  "registry.ci/",
+			expected: BuildCache{
+				From: []string{"type=local,src=" + localDir, "type=registry,ref=registry.ci/base:buildcache"},
+				To:   []string{"type=registry,ref=registry.ci/api:buildcache,mode=max"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		if cache := service.Cache(test.repository, test.environment); !reflect.DeepEqual(cache, test.expected) {
+			t.Errorf("expected the %s cache %+v, got %+v", test.environment, test.expected, cache)
+		}
+	}
+
+	hash, err := service.ContextHash([]string{}, "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner.On("docker inspect", testImageID+"\n", nil)
+	runner.On("docker inspect --format {{.Id}} registry.local/api:kip-", "", errors.New("no such image"))
+
+	if _, _, err := service.Build("", "latest", []string{}, "dev", false); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"build", service.Paths().Root, "-f", "Dockerfile", "-t", "registry.local/api:temp-latest", "-t", "registry.local/api:kip-" + hash, "--cache-from", "registry.local/api:buildcache", "--build-arg", "BUILDKIT_INLINE_CACHE=1"}
+	if args := runner.Calls()[1].Args; !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected docker %v, got %v", expected, args)
+	}
+
+	if _, err := registryCacheArgs(BuilderPodman, service.Cache("registry.ci/", "ci")); err == nil {
+		t.Error("expected podman to reject the local cache")
+	}
+
+	// the docker driver only exports the inline cache, registry exports need buildx
+	calls := len(runner.Calls())
+	runner.On("docker inspect --format {{.Id}} registry.ci/api:kip-", "", errors.New("no such image"))
+
+	if _, _, err := service.Build("", "latest", []string{}, "ci", false); err == nil || !strings.Contains(err.Error(), "buildx") {
+		t.Errorf("expected the registry cache export to be rejected, got %v", err)
+	}
+
+	for _, call := range runner.Calls()[calls:] {
+		if call.Args[0] == "build" {
+			t.Errorf("expected no docker build, got %s", call)
+		}
+	}
+}
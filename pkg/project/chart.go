@@ -0,0 +1,348 @@
+package project
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Chart is used for describing a chart
+type Chart struct {
+	name    string
+	path    string
+	Project Project
+}
+
+func (c Chart) Name() string {
+	return c.name
+}
+
+func (c Chart) Path() string {
+	return c.path
+}
+
+// render returns the templates of the chart as rendered by helm template
+func (c Chart) render(environment string, args []string) ([]byte, error) {
+	cmdArgs, err := getCommandArgsAndFiles(c, environment, args, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var stderr bytes.Buffer
+
+	manifest, err := output(c.commandRunner(), Command{Name: "helm", Args: cmdArgs, Dir: c.Path(), Stderr: &stderr})
+
+	if err != nil {
+		return nil, fmt.Errorf("helm template %s: %v\n%s", c.Name(), err, stderr.String())
+	}
+
+	return manifest, nil
+}
+
+func (c Chart) savedState(environment string) (DeployState, error) {
+	store, err := c.Project.StateStore(environment)
+	if err != nil {
+		return DeployState{}, err
+	}
+
+	return store.Get(c.stateKey(environment))
+}
+
+// hashManifest hashes the resources of the manifest, helm template and helm get manifest print the same
+// resources with different hooks, order and comments so both are hashed without them
+func hashManifest(manifest []byte) string {
+	resources := splitManifest(string(manifest))
+
+	keys := []string{}
+	for key := range resources {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, key := range keys {
+		resource := resources[key]
+		if isHook(resource) {
+			continue
+		}
+		fmt.Fprintf(h, "%s\x00%s\x00", key, stripComments(resource))
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func (c Chart) getHashes(environment string, args []string) (string, string, error) {
+	output, err := c.render(environment, args)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := c.savedState(environment)
+	if err != nil {
+		return "", "", err
+	}
+
+	return hashManifest(output), state.Hash, nil
+}
+
+// Diff returns the changes per kubernetes resource between the last deploy and the current templates
+func (c Chart) Diff(environment string, args []string) ([]ResourceDiff, error) {
+	output, err := c.render(environment, args)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := c.savedState(environment)
+	if err != nil {
+		return nil, err
+	}
+
+	// states saved by older versions of kip may still contain the values of secrets
+	return diffManifests(redactSecrets(state.Manifest), redactSecrets(string(output))), nil
+}
+
+func (c Chart) commandRunner() Runner {
+	if c.Project == nil {
+		return ExecRunner{}
+	}
+	return c.Project.commandRunner()
+}
+
+// stateKey returns the key the deploy state of the chart is saved with
+func (c Chart) stateKey(environment string) StateKey {
+	key := StateKey{Chart: c.Name(), Environment: environment}
+
+	switch p := c.Project.(type) {
+	case MonoProject:
+		key.Project = p.Name()
+	case ServiceProject:
+		if p.project != nil {
+			key.Project = p.project.Name()
+			key.Service = p.Name()
+		} else {
+			key.Project = p.Name()
+		}
+	}
+
+	return key
+}
+
+func (c Chart) IsChanged(environment string, args []string) (bool, error) {
+	commandHash, savedCommandHash, err := c.getHashes(environment, args)
+
+	if err != nil {
+		return false, err
+	}
+
+	return commandHash != savedCommandHash, nil
+}
+
+// Deploy upgrades or installs the chart, the helm command and its output are written to out
+func (c Chart) Deploy(out io.Writer, environment string, args []string) error {
+	manifest, err := c.render(environment, args)
+
+	if err != nil {
+		return err
+	}
+
+	cmdArgs, err := getCommandArgsAndFiles(c, environment, args, false)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "helm %s\n", strings.Join(cmdArgs, " "))
+
+	err = c.commandRunner().Run(Command{Name: "helm", Args: cmdArgs, Dir: c.Path(), Stdout: out, Stderr: out})
+
+	if err != nil {
+		return err
+	}
+
+	store, err := c.Project.StateStore(environment)
+	if err != nil {
+		return err
+	}
+
+	err = store.Save(c.stateKey(environment), DeployState{Hash: hashManifest(manifest), Manifest: string(manifest)})
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// clusterArgs returns the helm flags selecting the kube context and namespace of the environment
+func (c Chart) clusterArgs(environment string) []string {
+	cmdArgs := []string{}
+
+	if c.Project == nil {
+		return cmdArgs
+	}
+
+	if kubeContext := c.Project.KubeContext(environment); kubeContext != "" {
+		cmdArgs = append(cmdArgs, "--kube-context", kubeContext)
+	}
+
+	if namespace := c.Project.Namespace(environment); namespace != "" {
+		cmdArgs = append(cmdArgs, "--namespace", namespace)
+	}
+
+	return cmdArgs
+}
+
+func getCommandArgsAndFiles(c Chart, environment string, args []string, template bool) ([]string, error) {
+	cmdArgs := []string{}
+
+	if template {
+		cmdArgs = append(cmdArgs, []string{"template", c.Name(), "."}...)
+	} else {
+		cmdArgs = append(cmdArgs, []string{"upgrade", c.Name(), ".", "--install"}...)
+	}
+
+	if environment != "" {
+		// check if values file is global
+		if c.Project != nil {
+			valuesfilePath := filepath.Join(c.Project.Paths().Environments, fmt.Sprintf("values-%s.yaml", environment))
+			if _, err := os.Stat(valuesfilePath); err == nil {
+				cmdArgs = append(cmdArgs, "-f", valuesfilePath)
+			}
+
+			if c.Project != nil && c.Project.Template() == "service" {
+				valuesfilePath := filepath.Join(c.Project.(ServiceProject).Paths().Environments, fmt.Sprintf("values-%s.yaml", environment))
+				if _, err := os.Stat(valuesfilePath); err == nil {
+					cmdArgs = append(cmdArgs, "-f", valuesfilePath)
+				}
+			}
+		}
+
+		// check if values file is global
+		valuesfilePath := filepath.Join(c.Path(), fmt.Sprintf("../values-%s.yaml", environment))
+		if _, err := os.Stat(valuesfilePath); err == nil {
+			cmdArgs = append(cmdArgs, "-f", valuesfilePath)
+		}
+
+		// check in chart folder
+		valuesfilePath = filepath.Join(c.Path(), fmt.Sprintf("values-%s.yaml", environment))
+		if _, err := os.Stat(valuesfilePath); err == nil {
+			cmdArgs = append(cmdArgs, "-f", valuesfilePath)
+		}
+	}
+
+	cmdArgs = append(cmdArgs, c.clusterArgs(environment)...)
+
+	if c.Project != nil {
+		cmdArgs = append(cmdArgs, c.Project.HelmArgs(environment)...)
+	}
+
+	kipHelmArgs := strings.TrimSpace(os.Getenv("KIP_HELM_ARGS"))
+
+	if kipHelmArgs != "" {
+		helmArgs := strings.Split(kipHelmArgs, " ")
+		cmdArgs = append(cmdArgs, helmArgs...)
+	}
+
+	cmdArgs = append(cmdArgs, scriptHelmArgs()...)
+
+	cmdArgs = append(cmdArgs, args...)
+
+	return cmdArgs, nil
+}
+
+func getCharts(path string, project Project) ([]Chart, error) {
+	charts := []Chart{}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return charts, nil
+	}
+
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		if f.IsDir() {
+			chartFolder := f.Name()
+			c := Chart{name: chartFolder, path: filepath.Join(path, chartFolder), Project: project}
+			charts = append(charts, c)
+		}
+	}
+
+	return charts, nil
+}
+
+func createChart(runner Runner, name string, path string, args []string) (string, error) {
+	cmdArgs := []string{"create", name}
+	err := runner.Run(Command{Name: "helm", Args: append(cmdArgs, args...), Dir: path, Stdout: os.Stdout, Stderr: os.Stderr})
+	return path, err
+}
+
+// Release is a revision in the helm release history of a chart
+type Release struct {
+	Revision    int    `json:"revision"`
+	Updated     string `json:"updated"`
+	Status      string `json:"status"`
+	Chart       string `json:"chart"`
+	AppVersion  string `json:"app_version"`
+	Description string `json:"description"`
+}
+
+// History returns the helm releases of the chart, oldest first
+func (c Chart) History(environment string) ([]Release, error) {
+	cmdArgs := append([]string{"history", c.Name(), "-o", "json"}, c.clusterArgs(environment)...)
+	var stderr bytes.Buffer
+
+	history, err := output(c.commandRunner(), Command{Name: "helm", Args: cmdArgs, Dir: c.Path(), Stderr: &stderr})
+	if err != nil {
+		return nil, fmt.Errorf("helm history %s: %s", c.Name(), strings.TrimSpace(stderr.String()))
+	}
+
+	releases := []Release{}
+	if err := json.Unmarshal(history, &releases); err != nil {
+		return nil, err
+	}
+
+	return releases, nil
+}
+
+// Rollback rolls the chart back to a revision, 0 rolls back to the previous revision.
+// The saved deploy state is replaced by the manifest that is running after the rollback, its hash
+// matches the one of the rendered templates of that revision, see hashManifest
+func (c Chart) Rollback(out io.Writer, environment string, revision int) error {
+	cmdArgs := []string{"rollback", c.Name()}
+
+	if revision > 0 {
+		cmdArgs = append(cmdArgs, strconv.Itoa(revision))
+	}
+
+	cmdArgs = append(cmdArgs, c.clusterArgs(environment)...)
+
+	fmt.Fprintf(out, "helm %s\n", strings.Join(cmdArgs, " "))
+
+	if err := c.commandRunner().Run(Command{Name: "helm", Args: cmdArgs, Dir: c.Path(), Stdout: out, Stderr: out}); err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+
+	manifest, err := output(c.commandRunner(), Command{Name: "helm", Args: append([]string{"get", "manifest", c.Name()}, c.clusterArgs(environment)...), Dir: c.Path(), Stderr: &stderr})
+	if err != nil {
+		return fmt.Errorf("helm get manifest %s: %s", c.Name(), strings.TrimSpace(stderr.String()))
+	}
+
+	store, err := c.Project.StateStore(environment)
+	if err != nil {
+		return err
+	}
+
+	return store.Save(c.stateKey(environment), DeployState{Hash: hashManifest(manifest), Manifest: string(manifest)})
+}
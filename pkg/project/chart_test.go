@@ -0,0 +1,298 @@
+package project
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testManifest = `---
+# Source: web/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+`
+
+func unsetHelmArgs() func() {
+	value, set := os.LookupEnv("KIP_HELM_ARGS")
+	os.Unsetenv("KIP_HELM_ARGS")
+
+	return func() {
+		if set {
+			os.Setenv("KIP_HELM_ARGS", value)
+		}
+	}
+}
+
+func TestDeploy(t *testing.T) {
+	defer unsetHelmArgs()()
+
+	tests := []struct {
+		name       string
+		files      map[string]string
+		owner      func(t *testing.T, p Project) Project
+		expected   func(root string) [][]string
+		keepsState bool
+	}{
+		{
+			name: "project chart with secret state",
+			files: map[string]string{
+				"kip_config.yaml": `template: project
+environment: dev
+version: v0.0.0
+environments:
+  dev:
+    namespace: shop
+    kubeContext: dev-cluster
+    helmArgs:
+      - --atomic
+`,
+				"environments/values-dev.yaml": "replicas: 1\n",
+				"deployments/web/Chart.yaml":   "name: web\n",
+			},
+			owner: func(t *testing.T, p Project) Project { return p },
+			expected: func(root string) [][]string {
+				values := filepath.Join(root, "environments", "values-dev.yaml")
+				return [][]string{
+					{"helm", "template", "web", ".", "-f", values, "--kube-context", "dev-cluster", "--namespace", "shop", "--atomic", "-f", "images.yaml"},
+					{"kubectl", "get", "secret", "kip.shop.web.dev", "--ignore-not-found", "-o", "json", "--context", "dev-cluster", "--namespace", "shop"},
+					{"helm", "template", "web", ".", "-f", values, "--kube-context", "dev-cluster", "--namespace", "shop", "--atomic", "-f", "images.yaml"},
+					{"helm", "upgrade", "web", ".", "--install", "-f", values, "--kube-context", "dev-cluster", "--namespace", "shop", "--atomic", "-f", "images.yaml"},
+					{"kubectl", "apply", "--server-side", "--force-conflicts", "--field-manager", "kip", "-f", "-", "--context", "dev-cluster", "--namespace", "shop"},
+				}
+			},
+		},
+		{
+			name: "service chart in project with configmap state",
+			files: map[string]string{
+				"kip_config.yaml": `template: project
+environment: dev
+version: v0.0.0
+namespace: shop
+state:
+  backend: configmap
+`,
+				"services/web/kip_config.yaml":            "template: service\nversion: v0.0.0\n",
+				"services/web/deployments/web/Chart.yaml": "name: web\n",
+			},
+			owner: func(t *testing.T, p Project) Project { return testService(t, p, "web") },
+			expected: func(root string) [][]string {
+				return [][]string{
+					{"helm", "template", "web", ".", "--namespace", "shop", "-f", "images.yaml"},
+					{"kubectl", "get", "configmap", "kip.shop.web.web.dev", "--ignore-not-found", "-o", "json", "--namespace", "shop"},
+					{"helm", "template", "web", ".", "--namespace", "shop", "-f", "images.yaml"},
+					{"helm", "upgrade", "web", ".", "--install", "--namespace", "shop", "-f", "images.yaml"},
+					{"kubectl", "apply", "--server-side", "--force-conflicts", "--field-manager", "kip", "-f", "-", "--namespace", "shop"},
+				}
+			},
+		},
+		{
+			name: "service chart in project saves state in the cluster of the service",
+			files: map[string]string{
+				"kip_config.yaml": `template: project
+environment: dev
+version: v0.0.0
+namespace: shop
+kubeContext: shop-cluster
+state:
+  backend: configmap
+`,
+				"services/web/kip_config.yaml":            "template: service\nversion: v0.0.0\nnamespace: web\nkubeContext: web-cluster\n",
+				"services/web/deployments/web/Chart.yaml": "name: web\n",
+			},
+			owner: func(t *testing.T, p Project) Project { return testService(t, p, "web") },
+			expected: func(root string) [][]string {
+				return [][]string{
+					{"helm", "template", "web", ".", "--kube-context", "web-cluster", "--namespace", "web", "-f", "images.yaml"},
+					{"kubectl", "get", "configmap", "kip.shop.web.web.dev", "--ignore-not-found", "-o", "json", "--context", "web-cluster", "--namespace", "web"},
+					{"helm", "template", "web", ".", "--kube-context", "web-cluster", "--namespace", "web", "-f", "images.yaml"},
+					{"helm", "upgrade", "web", ".", "--install", "--kube-context", "web-cluster", "--namespace", "web", "-f", "images.yaml"},
+					{"kubectl", "apply", "--server-side", "--force-conflicts", "--field-manager", "kip", "-f", "-", "--context", "web-cluster", "--namespace", "web"},
+				}
+			},
+		},
+		{
+			name: "service chart with file state",
+			files: map[string]string{
+				"kip_config.yaml": `template: service
+environment: dev
+version: v0.0.0
+state:
+  backend: file
+`,
+				"deployments/web/Chart.yaml": "name: web\n",
+			},
+			owner: func(t *testing.T, p Project) Project { return p },
+			expected: func(root string) [][]string {
+				return [][]string{
+					{"helm", "template", "web", ".", "-f", "images.yaml"},
+					{"helm", "template", "web", ".", "-f", "images.yaml"},
+					{"helm", "upgrade", "web", ".", "--install", "-f", "images.yaml"},
+				}
+			},
+			keepsState: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			runner := &FakeRunner{}
+			p, cleanup := newTestProject(t, test.files, runner)
+			defer cleanup()
+
+			runner.On("helm template", testManifest, nil)
+
+			chart := testChart(t, test.owner(t, p), "web")
+			args := []string{"-f", "images.yaml"}
+
+			changed, err := chart.IsChanged("dev", args)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !changed {
+				t.Error("expected a chart without saved state to be changed")
+			}
+
+			if err := chart.Deploy(ioutil.Discard, "dev", args); err != nil {
+				t.Fatal(err)
+			}
+
+			assertCalls(t, runner, test.expected(p.Paths().Root))
+
+			for _, call := range runner.Calls() {
+				if call.Name == "helm" && call.Dir != chart.Path() {
+					t.Errorf("expected helm to run in %s, got %s", chart.Path(), call.Dir)
+				}
+
+				if call.Name == "kubectl" && call.Args[0] == "apply" && !strings.Contains(call.Stdin, hashManifest([]byte(testManifest))) {
+					t.Errorf("expected the applied state to contain the manifest hash, got %s", call.Stdin)
+				}
+			}
+
+			runner.Reset()
+
+			changed, err = chart.IsChanged("dev", args)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the kubernetes stores are faked, only the file store keeps the state
+			if test.keepsState && changed {
+				t.Error("expected the chart to be unchanged after deploying")
+			}
+		})
+	}
+}
+
+func TestIsChangedReadsSecretState(t *testing.T) {
+	defer unsetHelmArgs()()
+
+	runner := &FakeRunner{}
+	p, cleanup := newTestProject(t, map[string]string{
+		"kip_config.yaml":            "template: project\nenvironment: dev\nversion: v0.0.0\n",
+		"deployments/web/Chart.yaml": "name: web\n",
+	}, runner)
+	defer cleanup()
+
+	secret, _ := json.Marshal(map[string]interface{}{
+		"data": map[string]string{
+			"hash":     base64.StdEncoding.EncodeToString([]byte(hashManifest([]byte(testManifest)))),
+			"manifest": base64.StdEncoding.EncodeToString([]byte(testManifest)),
+		},
+	})
+
+	runner.On("helm template", testManifest, nil)
+	runner.On("kubectl get secret kip.shop.web.dev", string(secret), nil)
+
+	chart := testChart(t, p, "web")
+
+	changed, err := chart.IsChanged("dev", []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if changed {
+		t.Error("expected the chart to be unchanged")
+	}
+
+	diffs, err := chart.Diff("dev", []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(diffs) != 0 {
+		t.Errorf("expected no diffs, got %v", diffs)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	runner := &FakeRunner{}
+	p, cleanup := newTestProject(t, map[string]string{
+		"kip_config.yaml":            "template: project\nenvironment: dev\nversion: v0.0.0\nnamespace: shop\n",
+		"deployments/web/Chart.yaml": "name: web\n",
+	}, runner)
+	defer cleanup()
+
+	runner.On("helm get manifest", testManifest, nil)
+
+	if err := testChart(t, p, "web").Rollback(ioutil.Discard, "dev", 3); err != nil {
+		t.Fatal(err)
+	}
+
+	assertCalls(t, runner, [][]string{
+		{"helm", "rollback", "web", "3", "--namespace", "shop"},
+		{"helm", "get", "manifest", "web", "--namespace", "shop"},
+		{"kubectl", "apply", "--server-side", "--force-conflicts", "--field-manager", "kip", "-f", "-", "--namespace", "shop"},
+	})
+
+	if stdin := runner.Calls()[2].Stdin; !strings.Contains(stdin, fmt.Sprintf("%q", "kip.shop.web.dev")) {
+		t.Errorf("expected the state of the rolled back chart to be saved, got %s", stdin)
+	}
+}
+
+func TestRollbackStateMatchesTemplates(t *testing.T) {
+	defer unsetHelmArgs()()
+
+	runner := &FakeRunner{}
+	p, cleanup := newTestProject(t, map[string]string{
+		"kip_config.yaml":            "template: project\nenvironment: dev\nversion: v0.0.0\nstate:\n  backend: file\n",
+		"deployments/web/Chart.yaml": "name: web\n",
+	}, runner)
+	defer cleanup()
+
+	configMap := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\ndata:\n  run.sh: |\n    # migrate first\n    ./migrate\n"
+	hook := "apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: web-migrate\n  annotations:\n    helm.sh/hook: pre-upgrade\n"
+
+	// helm get manifest leaves out hooks and may order the resources differently than helm template
+	runner.On("helm get manifest", "---\n# Source: web/templates/configmap.yaml\n"+configMap+testManifest, nil)
+	runner.On("helm template", testManifest+"---\n# Source: web/templates/job.yaml\n"+hook+"---\n# Source: web/templates/configmap.yaml\n"+configMap, nil)
+
+	chart := testChart(t, p, "web")
+
+	if err := chart.Rollback(ioutil.Discard, "dev", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err := chart.IsChanged("dev", []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if changed {
+		t.Error("expected the templates of the rolled back revision to be unchanged")
+	}
+
+	// a changed comment inside a value is still a change
+	runner.On("helm template", testManifest+"---\n"+strings.Replace(configMap, "# migrate first", "# seed first", 1), nil)
+
+	if changed, err := chart.IsChanged("dev", []string{}); err != nil || !changed {
+		t.Errorf("expected the changed script to be a change, got %v %v", changed, err)
+	}
+}
@@ -0,0 +1,338 @@
+package project
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ResourceDiff is the unified diff of a single kubernetes resource between the last deploy and now
+type ResourceDiff struct {
+	Resource string
+	Diff     string
+}
+
+type manifestResource struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name        string            `yaml:"name"`
+		Namespace   string            `yaml:"namespace"`
+		Annotations map[string]string `yaml:"annotations"`
+	} `yaml:"metadata"`
+}
+
+// isHook reports if the resource is a helm hook, helm get manifest leaves hooks out
+func isHook(doc string) bool {
+	var resource manifestResource
+	if err := yaml.Unmarshal([]byte(doc), &resource); err != nil {
+		return false
+	}
+	_, ok := resource.Metadata.Annotations["helm.sh/hook"]
+	return ok
+}
+
+// stripComments removes the comments in front of a document, like the # Source line helm adds, and the
+// trailing whitespace of its lines. Comments inside values like a script in a ConfigMap are kept
+func stripComments(doc string) string {
+	lines := []string{}
+	for _, line := range strings.Split(doc, "\n") {
+		if len(lines) == 0 && (strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#")) {
+			continue
+		}
+		lines = append(lines, strings.TrimRight(line, " \t"))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// splitManifest splits rendered templates into documents keyed by kind, namespace and name
+func splitManifest(manifest string) map[string]string {
+	resources := map[string]string{}
+
+	for _, doc := range strings.Split("\n"+manifest, "\n---") {
+		doc = strings.Trim(doc, "\n")
+
+		var resource manifestResource
+		if err := yaml.Unmarshal([]byte(doc), &resource); err != nil || resource.Kind == "" {
+			continue
+		}
+
+		key := resource.Kind + "/" + resource.Metadata.Name
+		if resource.Metadata.Namespace != "" {
+			key = resource.Kind + "/" + resource.Metadata.Namespace + "/" + resource.Metadata.Name
+		}
+
+		resources[key] = doc + "\n"
+	}
+
+	return resources
+}
+
+// redactSecrets replaces every value in the data and stringData of secrets with a hash of it, so saved states
+// and diffs show which keys changed without containing the values
+func redactSecrets(manifest string) string {
+	docs := strings.Split(manifest, "\n---")
+
+	for i, doc := range docs {
+		docs[i] = redactSecret(doc)
+	}
+
+	return strings.Join(docs, "\n---")
+}
+
+func redactSecret(doc string) string {
+	var resource manifestResource
+	if err := yaml.Unmarshal([]byte(doc), &resource); err != nil || resource.Kind != "Secret" {
+		return doc
+	}
+
+	var fields yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(doc), &fields); err != nil {
+		return doc
+	}
+
+	for i, field := range fields {
+		if field.Key != "data" && field.Key != "stringData" {
+			continue
+		}
+
+		values, ok := field.Value.(yaml.MapSlice)
+		if !ok {
+			continue
+		}
+
+		for j, value := range values {
+			hash := sha256.Sum256([]byte(fmt.Sprint(value.Value)))
+			values[j].Value = "sha256:" + hex.EncodeToString(hash[:])
+		}
+		fields[i].Value = values
+	}
+
+	content, err := yaml.Marshal(fields)
+	if err != nil {
+		return doc
+	}
+
+	// keep the separator and the source comment helm puts in front of each template
+	lines := strings.SplitAfter(doc, "\n")
+	prefix := ""
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed != "" && trimmed != "---" && !strings.HasPrefix(trimmed, "#") {
+			break
+		}
+		prefix += line
+	}
+
+	redacted := prefix + string(content)
+	if !strings.HasSuffix(doc, "\n") {
+		redacted = strings.TrimSuffix(redacted, "\n")
+	}
+
+	return redacted
+}
+
+// diffManifests returns the diffs of all resources that were added, removed or changed
+func diffManifests(oldManifest string, newManifest string) []ResourceDiff {
+	oldResources := splitManifest(oldManifest)
+	newResources := splitManifest(newManifest)
+
+	keys := []string{}
+	for key := range oldResources {
+		keys = append(keys, key)
+	}
+	for key := range newResources {
+		if _, ok := oldResources[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	diffs := []ResourceDiff{}
+
+	for _, key := range keys {
+		if oldResources[key] == newResources[key] {
+			continue
+		}
+
+		diffs = append(diffs, ResourceDiff{Resource: key, Diff: unifiedDiff(key, oldResources[key], newResources[key])})
+	}
+
+	return diffs
+}
+
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// unifiedDiff returns a unified diff with three lines of context
+func unifiedDiff(name string, a string, b string) string {
+	aLines := splitLines(a)
+	bLines := splitLines(b)
+	lines := diffLines(aLines, bLines)
+
+	const context = 3
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- a/%s\n+++ b/%s\n", name, name)
+
+	for i := 0; i < len(lines); {
+		if lines[i].op == ' ' {
+			i++
+			continue
+		}
+
+		// extend the hunk until there are more than 2*context unchanged lines
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(lines) {
+			if lines[end].op != ' ' {
+				end++
+				continue
+			}
+			unchanged := end
+			for unchanged < len(lines) && lines[unchanged].op == ' ' {
+				unchanged++
+			}
+			if unchanged == len(lines) || unchanged-end > 2*context {
+				break
+			}
+			end = unchanged
+		}
+		stop := end + context
+		if stop > len(lines) {
+			stop = len(lines)
+		}
+
+		aStart, bStart := 1, 1
+		for _, line := range lines[:start] {
+			if line.op != '+' {
+				aStart++
+			}
+			if line.op != '-' {
+				bStart++
+			}
+		}
+		aCount, bCount := 0, 0
+		for _, line := range lines[start:stop] {
+			if line.op != '+' {
+				aCount++
+			}
+			if line.op != '-' {
+				bCount++
+			}
+		}
+		if aCount == 0 {
+			aStart--
+		}
+		if bCount == 0 {
+			bStart--
+		}
+
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount)
+		for _, line := range lines[start:stop] {
+			fmt.Fprintf(&sb, "%c%s\n", line.op, line.text)
+		}
+
+		i = stop
+	}
+
+	return sb.String()
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines computes the line based edit script using the longest common subsequence. The common prefix
+// and suffix are trimmed first, the table only covers the changed part of a resource
+func diffLines(a []string, b []string) []diffLine {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	lines := []diffLine{}
+	for _, text := range a[:prefix] {
+		lines = append(lines, diffLine{' ', text})
+	}
+
+	lines = append(lines, lcsDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+
+	for _, text := range a[len(a)-suffix:] {
+		lines = append(lines, diffLine{' ', text})
+	}
+
+	return lines
+}
+
+func lcsDiff(a []string, b []string) []diffLine {
+	lines := []diffLine{}
+
+	if len(a) == 0 || len(b) == 0 {
+		for _, text := range a {
+			lines = append(lines, diffLine{'-', text})
+		}
+		for _, text := range b {
+			lines = append(lines, diffLine{'+', text})
+		}
+		return lines
+	}
+
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+
+	for i < len(a) && j < len(b) {
+		if a[i] == b[j] {
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		} else if lcs[i+1][j] >= lcs[i][j+1] {
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		} else {
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+
+	for ; i < len(a); i++ {
+		lines = append(lines, diffLine{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, diffLine{'+', b[j]})
+	}
+
+	return lines
+}
@@ -0,0 +1,299 @@
+package project
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	serviceResource = `apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  port: 80
+`
+	deploymentResource = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: shop
+spec:
+  replicas: 1
+`
+	configMapResource = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+data:
+  key: value
+`
+)
+
+func TestSplitManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		expected map[string]string
+	}{
+		{
+			name:     "empty",
+			manifest: "",
+			expected: map[string]string{},
+		},
+		{
+			name:     "single document",
+			manifest: serviceResource,
+			expected: map[string]string{"Service/web": serviceResource},
+		},
+		{
+			name:     "multiple documents with sources and namespaces",
+			manifest: "---\n# Source: web/templates/service.yaml\n" + serviceResource + "---\n# Source: web/templates/deployment.yaml\n" + deploymentResource,
+			expected: map[string]string{
+				"Service/web":         "# Source: web/templates/service.yaml\n" + serviceResource,
+				"Deployment/shop/web": "# Source: web/templates/deployment.yaml\n" + deploymentResource,
+			},
+		},
+		{
+			name:     "documents without a kind are skipped",
+			manifest: "---\n# Source: web/templates/empty.yaml\n---\n" + configMapResource,
+			expected: map[string]string{"ConfigMap/web": configMapResource},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if resources := splitManifest(test.manifest); !reflect.DeepEqual(resources, test.expected) {
+				t.Errorf("expected %q, got %q", test.expected, resources)
+			}
+		})
+	}
+}
+
+func TestRedactSecrets(t *testing.T) {
+	secret := `apiVersion: v1
+kind: Secret
+metadata:
+  name: web
+type: Opaque
+data:
+  password: c2VjcmV0
+stringData:
+  token: secret
+`
+	redacted := `apiVersion: v1
+kind: Secret
+metadata:
+  name: web
+type: Opaque
+data:
+  password: sha256:` + sha256Hex("c2VjcmV0") + `
+stringData:
+  token: sha256:` + sha256Hex("secret") + `
+`
+
+	tests := []struct {
+		name     string
+		manifest string
+		expected string
+	}{
+		{
+			name:     "other resources are kept as they are",
+			manifest: serviceResource + "---\n" + configMapResource,
+			expected: serviceResource + "---\n" + configMapResource,
+		},
+		{
+			name:     "secret values are hashed",
+			manifest: secret,
+			expected: redacted,
+		},
+		{
+			name:     "separators and sources are kept",
+			manifest: "---\n# Source: web/templates/service.yaml\n" + serviceResource + "---\n# Source: web/templates/secret.yaml\n" + secret,
+			expected: "---\n# Source: web/templates/service.yaml\n" + serviceResource + "---\n# Source: web/templates/secret.yaml\n" + redacted,
+		},
+		{
+			name:     "secrets without data",
+			manifest: "apiVersion: v1\nkind: Secret\nmetadata:\n  name: web\n",
+			expected: "apiVersion: v1\nkind: Secret\nmetadata:\n  name: web\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if manifest := redactSecrets(test.manifest); manifest != test.expected {
+				t.Errorf("expected\n%s\ngot\n%s", test.expected, manifest)
+			}
+		})
+	}
+
+	// a changed value shows up in the diff without the value itself
+	changed := strings.Replace(secret, "token: secret", "token: changed", 1)
+	diffs := diffManifests(redactSecrets(secret), redactSecrets(changed))
+	if len(diffs) != 1 || strings.Contains(diffs[0].Diff, "secret\n") || strings.Contains(diffs[0].Diff, "changed") {
+		t.Errorf("expected a redacted diff of the secret, got %q", diffs)
+	}
+	if !strings.Contains(diffs[0].Diff, "-  token: sha256:"+sha256Hex("secret")) {
+		t.Errorf("expected the hash of the old value in the diff, got\n%s", diffs[0].Diff)
+	}
+}
+
+func sha256Hex(value string) string {
+	hash := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(hash[:])
+}
+
+func TestDiffManifests(t *testing.T) {
+	changedService := strings.Replace(serviceResource, "port: 80", "port: 8080", 1)
+
+	tests := []struct {
+		name     string
+		old      string
+		new      string
+		expected []ResourceDiff
+	}{
+		{
+			name:     "unchanged",
+			old:      serviceResource + "---\n" + deploymentResource,
+			new:      serviceResource + "---\n" + deploymentResource,
+			expected: []ResourceDiff{},
+		},
+		{
+			name: "added",
+			old:  serviceResource,
+			new:  serviceResource + "---\n" + configMapResource,
+			expected: []ResourceDiff{
+				{Resource: "ConfigMap/web", Diff: "--- a/ConfigMap/web\n+++ b/ConfigMap/web\n@@ -0,0 +1,6 @@\n" + prefixLines("+", configMapResource)},
+			},
+		},
+		{
+			name: "removed",
+			old:  serviceResource + "---\n" + configMapResource,
+			new:  serviceResource,
+			expected: []ResourceDiff{
+				{Resource: "ConfigMap/web", Diff: "--- a/ConfigMap/web\n+++ b/ConfigMap/web\n@@ -1,6 +0,0 @@\n" + prefixLines("-", configMapResource)},
+			},
+		},
+		{
+			name: "changed",
+			old:  deploymentResource + "---\n" + serviceResource,
+			new:  deploymentResource + "---\n" + changedService,
+			expected: []ResourceDiff{
+				{Resource: "Service/web", Diff: "--- a/Service/web\n+++ b/Service/web\n@@ -3,4 +3,4 @@\n metadata:\n   name: web\n spec:\n-  port: 80\n+  port: 8080\n"},
+			},
+		},
+		{
+			name: "sorted by resource",
+			old:  serviceResource + "---\n" + deploymentResource,
+			new:  configMapResource,
+			expected: []ResourceDiff{
+				{Resource: "ConfigMap/web", Diff: "--- a/ConfigMap/web\n+++ b/ConfigMap/web\n@@ -0,0 +1,6 @@\n" + prefixLines("+", configMapResource)},
+				{Resource: "Deployment/shop/web", Diff: "--- a/Deployment/shop/web\n+++ b/Deployment/shop/web\n@@ -1,7 +0,0 @@\n" + prefixLines("-", deploymentResource)},
+				{Resource: "Service/web", Diff: "--- a/Service/web\n+++ b/Service/web\n@@ -1,6 +0,0 @@\n" + prefixLines("-", serviceResource)},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if diffs := diffManifests(test.old, test.new); !reflect.DeepEqual(diffs, test.expected) {
+				t.Errorf("expected %q, got %q", test.expected, diffs)
+			}
+		})
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	lines := func(from int, to int) string {
+		var sb strings.Builder
+		for i := from; i <= to; i++ {
+			sb.WriteString(strings.Repeat("x", i) + "\n")
+		}
+		return sb.String()
+	}
+
+	tests := []struct {
+		name     string
+		a        string
+		b        string
+		expected string
+	}{
+		{
+			name:     "change in the middle keeps three lines of context",
+			a:        lines(1, 10),
+			b:        strings.Replace(lines(1, 10), "xxxxx\n", "y\n", 1),
+			expected: "@@ -2,7 +2,7 @@\n xx\n xxx\n xxxx\n-xxxxx\n+y\n xxxxxx\n xxxxxxx\n xxxxxxxx\n",
+		},
+		{
+			name:     "changes close to each other share a hunk",
+			a:        lines(1, 10),
+			b:        strings.Replace(strings.Replace(lines(1, 10), "xx\n", "y\n", 1), "xxxxxxxx\n", "z\n", 1),
+			expected: "@@ -1,10 +1,10 @@\n x\n-xx\n+y\n xxx\n xxxx\n xxxxx\n xxxxxx\n xxxxxxx\n-xxxxxxxx\n+z\n xxxxxxxxx\n xxxxxxxxxx\n",
+		},
+		{
+			name:     "changes far apart get their own hunks",
+			a:        lines(1, 20),
+			b:        strings.Replace(strings.Replace(lines(1, 20), "xx\n", "y\n", 1), strings.Repeat("x", 19)+"\n", "z\n", 1),
+			expected: "@@ -1,5 +1,5 @@\n x\n-xx\n+y\n xxx\n xxxx\n xxxxx\n@@ -16,5 +16,5 @@\n" + prefixLines(" ", lines(16, 18)) + "-" + strings.Repeat("x", 19) + "\n+z\n " + strings.Repeat("x", 20) + "\n",
+		},
+		{
+			name:     "appended lines",
+			a:        lines(1, 2),
+			b:        lines(1, 3),
+			expected: "@@ -1,2 +1,3 @@\n x\n xx\n+xxx\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expected := "--- a/test\n+++ b/test\n" + test.expected
+			if diff := unifiedDiff("test", test.a, test.b); diff != expected {
+				t.Errorf("expected\n%s\ngot\n%s", expected, diff)
+			}
+		})
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		a        []string
+		b        []string
+		expected string
+	}{
+		{name: "empty", a: []string{}, b: []string{}, expected: ""},
+		{name: "equal", a: []string{"a", "b"}, b: []string{"a", "b"}, expected: " a b"},
+		{name: "added", a: []string{}, b: []string{"a", "b"}, expected: "+a+b"},
+		{name: "removed", a: []string{"a", "b"}, b: []string{}, expected: "-a-b"},
+		{name: "changed in the middle", a: []string{"a", "b", "c"}, b: []string{"a", "x", "c"}, expected: " a-b+x c"},
+		{name: "inserted at the start", a: []string{"b", "c"}, b: []string{"a", "b", "c"}, expected: "+a b c"},
+		{name: "removed at the end", a: []string{"a", "b", "c"}, b: []string{"a", "b"}, expected: " a b-c"},
+		{name: "moved", a: []string{"a", "b", "c", "d"}, b: []string{"a", "c", "b", "d"}, expected: " a-b c+b d"},
+		{name: "repeated lines", a: []string{"a", "a", "a"}, b: []string{"a", "a"}, expected: " a a-a"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var sb strings.Builder
+			for _, line := range diffLines(test.a, test.b) {
+				sb.WriteByte(line.op)
+				sb.WriteString(line.text)
+			}
+
+			if sb.String() != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, sb.String())
+			}
+		})
+	}
+}
+
+func prefixLines(prefix string, s string) string {
+	var sb strings.Builder
+	for _, line := range splitLines(s) {
+		sb.WriteString(prefix + line + "\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,136 @@
+package project
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// DockerBackendCLI runs the docker CLI for every image operation
+	DockerBackendCLI = "cli"
+	// DockerBackendAPI talks to the Docker Engine API over DOCKER_HOST
+	DockerBackendAPI = "api"
+)
+
+// dockerCLI runs the docker CLI, or the compatible podman CLI, through the runner of the project
+type dockerCLI struct {
+	name   string
+	runner Runner
+	dir    string
+}
+
+func (d dockerCLI) Build(build ImageBuild) ([]byte, error) {
+	cacheArgs, err := buildkitCacheArgs(build.Cache, false)
+	if err != nil {
+		return nil, err
+	}
+	return d.build(build, cacheArgs)
+}
+
+func (d dockerCLI) build(build ImageBuild, cacheArgs []string) ([]byte, error) {
+	cmdArgs := []string{"build", build.Context, "-f", build.Dockerfile}
+	for _, tag := range build.Tags {
+		cmdArgs = append(cmdArgs, "-t", tag)
+	}
+	cmdArgs = append(cmdArgs, cacheArgs...)
+	cmdArgs = append(cmdArgs, build.Args...)
+	return streamOutput(d.runner, Command{Name: d.name, Args: cmdArgs, Dir: build.Context}, build.Output)
+}
+
+func (d dockerCLI) ImageID(image string) (string, error) {
+	out, err := output(d.runner, Command{Name: d.name, Args: []string{"inspect", "--format", "{{.Id}}", image}, Dir: d.dir})
+	if err != nil {
+		return "", err
+	}
+	return normalizeImageID(string(out)), nil
+}
+
+func (d dockerCLI) RepoDigests(image string) ([]string, error) {
+	out, err := output(d.runner, Command{Name: d.name, Args: []string{"inspect", "--format", "{{join .RepoDigests \"\\n\"}}", image}, Dir: d.dir})
+	if err != nil {
+		return nil, err
+	}
+
+	digests := []string{}
+	for _, digest := range strings.Split(string(out), "\n") {
+		if digest = strings.TrimSpace(digest); digest != "" {
+			digests = append(digests, digest)
+		}
+	}
+	return digests, nil
+}
+
+func (d dockerCLI) Tag(source string, target string) error {
+	_, err := combinedOutput(d.runner, Command{Name: d.name, Args: []string{"tag", source, target}, Dir: d.dir})
+	return err
+}
+
+func (d dockerCLI) Push(image string, args []string) ([]byte, error) {
+	cmdArgs := append([]string{"push", image}, args...)
+	return combinedOutput(d.runner, Command{Name: d.name, Args: cmdArgs, Dir: d.dir})
+}
+
+// podman builds like docker but does not record the digests of pushed images
+type podman struct {
+	dockerCLI
+	digests digestStore
+}
+
+func (p podman) Build(build ImageBuild) ([]byte, error) {
+	cacheArgs, err := registryCacheArgs(BuilderPodman, build.Cache)
+	if err != nil {
+		return nil, err
+	}
+	return p.build(build, cacheArgs)
+}
+
+func (p podman) Push(image string, args []string) ([]byte, error) {
+	digestFile, err := tempDigestFile()
+	if err != nil {
+		return nil, err
+	}
+
+	cmdArgs := append([]string{"push", "--digestfile", digestFile, image}, args...)
+	out, err := combinedOutput(p.runner, Command{Name: p.name, Args: cmdArgs, Dir: p.dir})
+	if err != nil {
+		os.Remove(digestFile)
+		return out, err
+	}
+
+	digest, err := readDigestFile(digestFile)
+	if err != nil {
+		return out, err
+	}
+
+	return out, p.digests.save(digest, image)
+}
+
+func (p podman) RepoDigests(image string) ([]string, error) {
+	return p.digests.repoDigests(image)
+}
+
+// DockerBackend returns how the service talks to docker, cli or api
+func (s ServiceProject) DockerBackend() string {
+	if s.config.IsSet("dockerBackend") {
+		return s.config.GetString("dockerBackend")
+	}
+
+	if s.project != nil {
+		return s.project.DockerBackend()
+	}
+
+	return DockerBackendCLI
+}
+
+// docker returns the client for the configured docker backend
+func (s ServiceProject) docker() (Builder, error) {
+	switch backend := s.DockerBackend(); backend {
+	case "", DockerBackendCLI:
+		return dockerCLI{name: "docker", runner: s.commandRunner(), dir: s.Paths().Root}, nil
+	case DockerBackendAPI:
+		return sharedDockerAPI(os.Getenv("DOCKER_HOST"))
+	default:
+		return nil, fmt.Errorf("docker backend \"%s\" not supported, use %s or %s", backend, DockerBackendCLI, DockerBackendAPI)
+	}
+}
@@ -0,0 +1,479 @@
+package project
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const defaultDockerHost = "unix:///var/run/docker.sock"
+
+// DockerAPI talks to the Docker Engine API instead of starting a docker process per call
+type DockerAPI struct {
+	client *http.Client
+	url    string
+}
+
+// NewDockerAPI creates a client for a docker host like unix:///var/run/docker.sock or tcp://127.0.0.1:2375,
+// the default socket is used when host is empty
+func NewDockerAPI(host string) (*DockerAPI, error) {
+	if host == "" {
+		host = defaultDockerHost
+	}
+
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid docker host \"%s\": %v", host, err)
+	}
+
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _ string, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		}
+		return &DockerAPI{client: &http.Client{Transport: transport}, url: "http://docker"}, nil
+	case "tcp", "http":
+		if os.Getenv("DOCKER_TLS_VERIFY") != "" {
+			return nil, errors.New("the docker api backend does not support DOCKER_TLS_VERIFY, use the cli backend")
+		}
+		return &DockerAPI{client: &http.Client{}, url: "http://" + u.Host}, nil
+	default:
+		return nil, fmt.Errorf("docker host \"%s\" not supported, use unix:// or tcp://", host)
+	}
+}
+
+var dockerAPIClients = struct {
+	sync.Mutex
+	clients map[string]*DockerAPI
+}{clients: map[string]*DockerAPI{}}
+
+// sharedDockerAPI returns one client per host so services share their connections
+func sharedDockerAPI(host string) (*DockerAPI, error) {
+	dockerAPIClients.Lock()
+	defer dockerAPIClients.Unlock()
+
+	if client, ok := dockerAPIClients.clients[host]; ok {
+		return client, nil
+	}
+
+	client, err := NewDockerAPI(host)
+	if err != nil {
+		return nil, err
+	}
+
+	dockerAPIClients.clients[host] = client
+	return client, nil
+}
+
+// dockerMessage is a line of the json stream returned by build and push
+type dockerMessage struct {
+	Stream   string `json:"stream"`
+	Status   string `json:"status"`
+	Progress string `json:"progress"`
+	ID       string `json:"id"`
+	Error    string `json:"error"`
+}
+
+func (d *DockerAPI) request(method string, endpoint string, query url.Values, body io.Reader, header http.Header) (*http.Response, error) {
+	u := d.url + endpoint
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		content, _ := ioutil.ReadAll(resp.Body)
+		if json.Unmarshal(content, &apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(content))
+		}
+
+		return nil, fmt.Errorf("docker api %s %s: %s", method, endpoint, apiErr.Message)
+	}
+
+	return resp, nil
+}
+
+// readMessages writes the build or push output of the stream to out and returns the first error message
+func readMessages(body io.Reader, out io.Writer) error {
+	decoder := json.NewDecoder(body)
+
+	for {
+		var message dockerMessage
+		if err := decoder.Decode(&message); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if message.Error != "" {
+			fmt.Fprintln(out, message.Error)
+			return errors.New(message.Error)
+		}
+
+		if message.Stream != "" {
+			fmt.Fprint(out, message.Stream)
+		} else if message.Status != "" && message.Progress == "" {
+			if message.ID != "" {
+				fmt.Fprintf(out, "%s: %s\n", message.ID, message.Status)
+			} else {
+				fmt.Fprintln(out, message.Status)
+			}
+		}
+	}
+}
+
+func (d *DockerAPI) Build(build ImageBuild) ([]byte, error) {
+	query, err := dockerBuildQuery(build)
+	if err != nil {
+		return nil, err
+	}
+
+	dockerfile := filepath.ToSlash(build.Dockerfile)
+	if strings.HasPrefix(dockerfile, "../") {
+		// the Dockerfile is outside the context, it is sent next to it like the docker CLI does
+		dockerfile = ".kip.Dockerfile"
+	}
+	query.Set("dockerfile", dockerfile)
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(writeBuildContext(writer, build.Context, build.Dockerfile, dockerfile))
+	}()
+	defer reader.Close()
+
+	resp, err := d.request(http.MethodPost, "/build", query, reader, http.Header{"Content-Type": {"application/x-tar"}})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// the stream is forwarded while the build runs, it is only kept when there is no writer
+	if build.Output != nil {
+		return nil, readMessages(resp.Body, build.Output)
+	}
+
+	var out bytes.Buffer
+	err = readMessages(resp.Body, &out)
+	return out.Bytes(), err
+}
+
+// dockerBuildQuery translates the docker build arguments to the query of the build endpoint. The backend
+// builds with the classic builder, version 1 of the endpoint, BuildKit needs the cli backend
+func dockerBuildQuery(build ImageBuild) (url.Values, error) {
+	query := url.Values{"version": {"1"}}
+	buildArgs := map[string]*string{}
+	labels := map[string]string{}
+	cacheFrom := []string{}
+
+	for _, tag := range build.Tags {
+		query.Add("t", tag)
+	}
+
+	// the engine api only imports caches from images, inline caches are exported with a build arg
+	for _, spec := range build.Cache.From {
+		ref, err := registryCacheRef("the docker api backend", spec)
+		if err != nil {
+			return nil, err
+		}
+		cacheFrom = append(cacheFrom, ref)
+	}
+
+	// the classic builder does not export caches, BUILDKIT_INLINE_CACHE would be ignored
+	if len(build.Cache.To) > 0 {
+		return nil, fmt.Errorf("the docker api backend builds without BuildKit and can not export the cache \"%s\", use dockerBackend: cli", build.Cache.To[0])
+	}
+
+	args := build.Args
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := args[i], "", false
+		if index := strings.Index(name, "="); strings.HasPrefix(name, "--") && index > 0 {
+			name, value, hasValue = name[:index], name[index+1:], true
+		}
+
+		switch name {
+		case "--no-cache", "--pull":
+			query.Set(strings.ReplaceAll(name[2:], "-", ""), "1")
+			continue
+		case "--build-arg", "--target", "--label", "--network", "--platform", "--cache-from":
+		default:
+			return nil, fmt.Errorf("docker build argument \"%s\" is not supported by the docker api backend", args[i])
+		}
+
+		if !hasValue {
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("docker build argument \"%s\" needs a value", name)
+			}
+			i++
+			value = args[i]
+		}
+
+		switch name {
+		case "--build-arg":
+			parts := strings.SplitN(value, "=", 2)
+			if len(parts) == 2 {
+				buildArgs[parts[0]] = &parts[1]
+			} else if env, ok := os.LookupEnv(parts[0]); ok {
+				buildArgs[parts[0]] = &env
+			}
+		case "--label":
+			parts := strings.SplitN(value, "=", 2)
+			labels[parts[0]] = ""
+			if len(parts) == 2 {
+				labels[parts[0]] = parts[1]
+			}
+		case "--target":
+			query.Set("target", value)
+		case "--network":
+			query.Set("networkmode", value)
+		case "--platform":
+			query.Set("platform", value)
+		case "--cache-from":
+			cacheFrom = append(cacheFrom, value)
+		}
+	}
+
+	for key, value := range map[string]interface{}{"buildargs": buildArgs, "labels": labels, "cachefrom": cacheFrom} {
+		content, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		if string(content) != "{}" && string(content) != "[]" {
+			query.Set(key, string(content))
+		}
+	}
+
+	return query, nil
+}
+
+// writeBuildContext writes the context without ignored files as tar, the Dockerfile is always included
+func writeBuildContext(w io.Writer, contextPath string, dockerfilePath string, dockerfileName string) error {
+	if !filepath.IsAbs(dockerfilePath) {
+		dockerfilePath = filepath.Join(contextPath, dockerfilePath)
+	}
+
+	files, err := contextFiles(contextPath, dockerfilePath)
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+
+	hasDockerfile := false
+	for _, file := range files {
+		if file == dockerfileName {
+			hasDockerfile = true
+		}
+		if err := addTarFile(tw, filepath.Join(contextPath, filepath.FromSlash(file)), file); err != nil {
+			return err
+		}
+	}
+
+	if !hasDockerfile {
+		if err := addTarFile(tw, dockerfilePath, dockerfileName); err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+func addTarFile(tw *tar.Writer, file string, name string) error {
+	info, err := os.Lstat(file)
+	if err != nil {
+		return err
+	}
+
+	link := ""
+	if info.Mode()&os.ModeSymlink != 0 {
+		if link, err = os.Readlink(file); err != nil {
+			return err
+		}
+	}
+
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+type dockerImageInspect struct {
+	ID          string   `json:"Id"`
+	RepoDigests []string `json:"RepoDigests"`
+}
+
+func (d *DockerAPI) inspect(image string) (dockerImageInspect, error) {
+	inspect := dockerImageInspect{}
+
+	resp, err := d.request(http.MethodGet, "/images/"+image+"/json", nil, nil, nil)
+	if err != nil {
+		return inspect, err
+	}
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(&inspect)
+	return inspect, err
+}
+
+func (d *DockerAPI) ImageID(image string) (string, error) {
+	inspect, err := d.inspect(image)
+	return inspect.ID, err
+}
+
+func (d *DockerAPI) RepoDigests(image string) ([]string, error) {
+	inspect, err := d.inspect(image)
+	return inspect.RepoDigests, err
+}
+
+func (d *DockerAPI) Tag(source string, target string) error {
+	repository, tag := splitImageTag(target)
+
+	resp, err := d.request(http.MethodPost, "/images/"+source+"/tag", url.Values{"repo": {repository}, "tag": {tag}}, nil, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (d *DockerAPI) Push(image string, args []string) ([]byte, error) {
+	if len(args) > 0 {
+		return nil, fmt.Errorf("docker push arguments %v are not supported by the docker api backend", args)
+	}
+
+	repository, tag := splitImageTag(image)
+
+	resp, err := d.request(http.MethodPost, "/images/"+repository+"/push", url.Values{"tag": {tag}}, nil, http.Header{"X-Registry-Auth": {registryAuth(repository)}})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out bytes.Buffer
+	err = readMessages(resp.Body, &out)
+	return out.Bytes(), err
+}
+
+// splitImageTag splits registry.local/name:tag into the repository and the tag
+func splitImageTag(image string) (string, string) {
+	index := strings.LastIndex(image, ":")
+	if index < 0 || strings.Contains(image[index:], "/") {
+		return image, "latest"
+	}
+	return image[:index], image[index+1:]
+}
+
+// registryAuth returns the X-Registry-Auth header for the registry of the repository. Only
+// credentials stored in the docker config are used, credential helpers need the cli backend
+func registryAuth(repository string) string {
+	empty := base64.URLEncoding.EncodeToString([]byte("{}"))
+
+	registry := "index.docker.io"
+	if parts := strings.SplitN(repository, "/", 2); len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") && parts[0] != "docker.io" {
+		registry = parts[0]
+	}
+
+	configDir := os.Getenv("DOCKER_CONFIG")
+	if configDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return empty
+		}
+		configDir = filepath.Join(home, ".docker")
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(configDir, "config.json"))
+	if err != nil {
+		return empty
+	}
+
+	var config struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(content, &config); err != nil {
+		return empty
+	}
+
+	for address, auth := range config.Auths {
+		if registryHost(address) != registry {
+			continue
+		}
+
+		credentials, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err != nil {
+			return empty
+		}
+
+		parts := strings.SplitN(string(credentials), ":", 2)
+		if len(parts) != 2 {
+			return empty
+		}
+
+		header, err := json.Marshal(map[string]string{"username": parts[0], "password": parts[1], "serveraddress": address})
+		if err != nil {
+			return empty
+		}
+		return base64.URLEncoding.EncodeToString(header)
+	}
+
+	return empty
+}
+
+// registryHost returns the host of a registry address like https://index.docker.io/v1/
+func registryHost(address string) string {
+	address = strings.TrimPrefix(strings.TrimPrefix(address, "https://"), "http://")
+	return strings.SplitN(address, "/", 2)[0]
+}
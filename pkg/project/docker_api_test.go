@@ -0,0 +1,284 @@
+package project
+
+import (
+	"archive/tar"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testDigest = "sha256:fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210"
+
+// fakeDockerAPI mimics the parts of the Docker Engine API kip uses
+type fakeDockerAPI struct {
+	mu           sync.Mutex
+	requests     []string
+	images       map[string]string
+	digests      map[string][]string
+	contextFiles []string
+	buildQuery   map[string][]string
+	auth         string
+}
+
+func newFakeDockerAPI() (*fakeDockerAPI, *httptest.Server) {
+	api := &fakeDockerAPI{images: map[string]string{}, digests: map[string][]string{}}
+	return api, httptest.NewServer(api)
+}
+
+func (f *fakeDockerAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	query := r.URL.Query()
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/build":
+		f.buildQuery = query
+		tr := tar.NewReader(r.Body)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			f.contextFiles = append(f.contextFiles, header.Name)
+		}
+		for _, tag := range query["t"] {
+			f.images[tag] = testImageID
+		}
+		fmt.Fprintln(w, `{"stream":"Step 1/1 : FROM scratch\n"}`)
+		fmt.Fprintf(w, "{\"aux\":{\"ID\":\"%s\"}}\n", testImageID)
+		fmt.Fprintln(w, `{"stream":"Successfully built 0123456789ab\n"}`)
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/json"):
+		name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/images/"), "/json")
+		id, ok := f.images[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, "{\"message\":\"No such image: %s\"}", name)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"Id": id, "RepoDigests": f.digests[name]})
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/tag"):
+		name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/images/"), "/tag")
+		f.images[query.Get("repo")+":"+query.Get("tag")] = f.images[name]
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/push"):
+		repository := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/images/"), "/push")
+		f.auth = r.Header.Get("X-Registry-Auth")
+		f.digests[repository+":"+query.Get("tag")] = []string{repository + "@" + testDigest}
+		fmt.Fprintln(w, `{"status":"Pushing","progress":"[=>  ]","id":"abc"}`)
+		fmt.Fprintln(w, `{"status":"Pushed","id":"abc"}`)
+		fmt.Fprintf(w, "{\"status\":\"%s: digest: %s\"}\n", query.Get("tag"), testDigest)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestDockerAPIBuildAndPush(t *testing.T) {
+	api, server := newFakeDockerAPI()
+	defer server.Close()
+
+	configDir, err := ioutil.TempDir("", "kip-docker-config-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(configDir)
+
+	auth := base64.StdEncoding.EncodeToString([]byte("kip:secret"))
+	if err := ioutil.WriteFile(filepath.Join(configDir, "config.json"), []byte(`{"auths":{"registry.local":{"auth":"`+auth+`"}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Setenv("DOCKER_HOST", os.Getenv("DOCKER_HOST"))
+	defer os.Setenv("DOCKER_CONFIG", os.Getenv("DOCKER_CONFIG"))
+	os.Setenv("DOCKER_HOST", strings.Replace(server.URL, "http://", "tcp://", 1))
+	os.Setenv("DOCKER_CONFIG", configDir)
+
+	p, cleanup := newTestProject(t, map[string]string{
+		"kip_config.yaml": `template: project
+environment: dev
+version: v0.0.0
+dockerBackend: api
+environments:
+  dev:
+    repository: registry.local/
+`,
+		"services/api/kip_config.yaml": "template: service\nversion: v0.0.0\n",
+		"services/api/Dockerfile":      "FROM scratch\n",
+		"services/api/.dockerignore":   "secret.txt\n",
+		"services/api/app.txt":         "app\n",
+		"services/api/secret.txt":      "secret\n",
+	}, &FakeRunner{})
+	defer cleanup()
+
+	service := testService(t, p, "api")
+	args := []string{"--build-arg", "VERSION=1", "--target=release"}
+
+	hash, err := service.ContextHash(args, "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, skipped, err := service.Build("", "latest", args, "dev", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if skipped {
+		t.Error("expected the build not to be skipped")
+	}
+
+	if !strings.Contains(string(output), "Successfully built 0123456789ab") {
+		t.Errorf("expected the build output of the stream, got %q", output)
+	}
+
+	sort.Strings(api.contextFiles)
+	if expected := []string{".dockerignore", "Dockerfile", "app.txt", "kip_config.yaml"}; !reflect.DeepEqual(api.contextFiles, expected) {
+		t.Errorf("expected the build context %v, got %v", expected, api.contextFiles)
+	}
+
+	expectedQuery := map[string][]string{
+		"t":          {"registry.local/api:temp-latest", "registry.local/api:kip-" + hash},
+		"dockerfile": {"Dockerfile"},
+		"buildargs":  {`{"VERSION":"1"}`},
+		"target":     {"release"},
+		"version":    {"1"},
+	}
+	if !reflect.DeepEqual(api.buildQuery, expectedQuery) {
+		t.Errorf("expected the build query %v, got %v", expectedQuery, api.buildQuery)
+	}
+
+	if _, err := service.Push("", "latest", []string{}, "dev"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"GET /images/registry.local/api:kip-" + hash + "/json",
+		"POST /build",
+		"GET /images/registry.local/api:temp-latest/json",
+		"POST /images/registry.local/api:temp-latest/tag",
+		"POST /images/registry.local/api:temp-latest/tag",
+		"GET /images/registry.local/api:latest/json",
+		"POST /images/registry.local/api/push",
+		"GET /images/registry.local/api:latest/json",
+		"GET /images/registry.local/api:0123456789ab/json",
+	}
+	if !reflect.DeepEqual(api.requests, expected) {
+		t.Errorf("expected the requests\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(api.requests, "\n"))
+	}
+
+	credentials, err := base64.URLEncoding.DecodeString(api.auth)
+	if err != nil || !strings.Contains(string(credentials), `"username":"kip"`) {
+		t.Errorf("expected the registry credentials of the docker config, got %s", credentials)
+	}
+
+	image, err := service.Image("", "latest", "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if image.Digest != testDigest {
+		t.Errorf("expected the pushed digest %s, got %s", testDigest, image.Digest)
+	}
+}
+
+func TestDockerBuildQueryUnsupportedArgument(t *testing.T) {
+	_, err := dockerBuildQuery(ImageBuild{Args: []string{"--squash"}})
+	if err == nil || !strings.Contains(err.Error(), "--squash") {
+		t.Errorf("expected an error for --squash, got %v", err)
+	}
+}
+
+// firstWriteWriter signals the first write, the output of a build has to arrive before it finished
+type firstWriteWriter struct {
+	once    sync.Once
+	written chan struct{}
+	mu      sync.Mutex
+	out     strings.Builder
+}
+
+func (w *firstWriteWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.once.Do(func() { close(w.written) })
+	return w.out.Write(p)
+}
+
+func TestDockerAPIBuildStreamsOutput(t *testing.T) {
+	out := &firstWriteWriter{written: make(chan struct{})}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(ioutil.Discard, r.Body)
+
+		fmt.Fprintln(w, `{"stream":"Step 1/2 : FROM scratch\n"}`)
+		w.(http.Flusher).Flush()
+
+		select {
+		case <-out.written:
+			fmt.Fprintln(w, `{"stream":"Successfully built 0123456789ab\n"}`)
+		case <-time.After(5 * time.Second):
+			fmt.Fprintln(w, `{"error":"the first step was not forwarded while the build was running"}`)
+		}
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "kip-build-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	api, err := NewDockerAPI(strings.Replace(server.URL, "http://", "tcp://", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := api.Build(ImageBuild{Context: dir, Dockerfile: "Dockerfile", Output: out})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(output) != 0 {
+		t.Errorf("expected no buffered output, got %q", output)
+	}
+
+	if expected := "Step 1/2 : FROM scratch\nSuccessfully built 0123456789ab\n"; out.out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.out.String())
+	}
+}
+
+func TestDockerBuildQueryCacheExport(t *testing.T) {
+	query, err := dockerBuildQuery(ImageBuild{Cache: BuildCache{From: []string{"type=registry,ref=registry.local/api:cache"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if query.Get("version") != "1" || query.Get("cachefrom") != `["registry.local/api:cache"]` {
+		t.Errorf("expected a classic build importing the cache image, got %v", query)
+	}
+
+	_, err = dockerBuildQuery(ImageBuild{Cache: BuildCache{To: []string{"type=inline"}}})
+	if err == nil || !strings.Contains(err.Error(), "dockerBackend: cli") {
+		t.Errorf("expected cache exports to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+package project
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrProjectNotFound is returned when no kip_config.yaml is found in a directory or its parents
+	ErrProjectNotFound = errors.New("kip_config not found")
+	// ErrServiceNotFound is returned when a project has no service with the requested name
+	ErrServiceNotFound = errors.New("service not found")
+	// ErrScriptNotFound is returned when a project has no script with the requested name
+	ErrScriptNotFound = errors.New("script not found")
+)
+
+// ConfigError is returned when a kip_config.yaml can not be read or decoded
+type ConfigError struct {
+	Path string
+	Err  error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,88 @@
+package project
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// FakeCall is a command recorded by the FakeRunner
+type FakeCall struct {
+	Name  string
+	Args  []string
+	Dir   string
+	Stdin string
+}
+
+func (c FakeCall) String() string {
+	return strings.Join(append([]string{c.Name}, c.Args...), " ")
+}
+
+type fakeResponse struct {
+	prefix string
+	stdout string
+	err    error
+}
+
+// FakeRunner records commands instead of running them, it is meant for tests
+type FakeRunner struct {
+	mu        sync.Mutex
+	calls     []FakeCall
+	responses []fakeResponse
+}
+
+// On makes commands starting with prefix write stdout and return err, the last matching response wins
+func (f *FakeRunner) On(prefix string, stdout string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses = append(f.responses, fakeResponse{prefix: prefix, stdout: stdout, err: err})
+}
+
+func (f *FakeRunner) Run(c Command) error {
+	call := FakeCall{Name: c.Name, Args: append([]string{}, c.Args...), Dir: c.Dir}
+
+	if c.Stdin != nil {
+		stdin, err := ioutil.ReadAll(c.Stdin)
+		if err != nil {
+			return err
+		}
+		call.Stdin = string(stdin)
+	}
+
+	f.mu.Lock()
+	f.calls = append(f.calls, call)
+
+	var response *fakeResponse
+	for i := len(f.responses) - 1; i >= 0; i-- {
+		if strings.HasPrefix(call.String(), f.responses[i].prefix) {
+			response = &f.responses[i]
+			break
+		}
+	}
+	f.mu.Unlock()
+
+	if response == nil {
+		return nil
+	}
+
+	if c.Stdout != nil && response.stdout != "" {
+		io.WriteString(c.Stdout, response.stdout)
+	}
+
+	return response.err
+}
+
+// Calls returns the recorded commands in the order they were run
+func (f *FakeRunner) Calls() []FakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeCall{}, f.calls...)
+}
+
+// Reset forgets the recorded commands but keeps the responses
+func (f *FakeRunner) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = nil
+}
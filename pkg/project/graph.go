@@ -0,0 +1,104 @@
+package project
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DependsOn returns the names of the services that have to be built before this service
+func (s ServiceProject) DependsOn() []string {
+	return s.config.GetStringSlice("dependsOn")
+}
+
+// SortServices orders the services so every service comes after the services it depends on.
+// Dependencies that are not part of services are ignored, a cycle returns an error
+func SortServices(services []ServiceProject) ([]ServiceProject, error) {
+	byName := map[string]ServiceProject{}
+	for _, service := range services {
+		byName[service.Name()] = service
+	}
+
+	sorted := []ServiceProject{}
+	visited := map[string]bool{}
+	visiting := map[string]bool{}
+	path := []string{}
+
+	var visit func(service ServiceProject) error
+	visit = func(service ServiceProject) error {
+		name := service.Name()
+
+		if visited[name] {
+			return nil
+		}
+
+		path = append(path, name)
+
+		if visiting[name] {
+			start := 0
+			for i, p := range path {
+				if p == name {
+					start = i
+					break
+				}
+			}
+			return fmt.Errorf("dependency cycle detected: %s", strings.Join(path[start:], " -> "))
+		}
+
+		visiting[name] = true
+
+		for _, dependency := range service.DependsOn() {
+			if dependencyService, ok := byName[dependency]; ok {
+				if err := visit(dependencyService); err != nil {
+					return err
+				}
+			}
+		}
+
+		visiting[name] = false
+		visited[name] = true
+		path = path[:len(path)-1]
+		sorted = append(sorted, service)
+
+		return nil
+	}
+
+	for _, service := range services {
+		if err := visit(service); err != nil {
+			return nil, err
+		}
+	}
+
+	return sorted, nil
+}
+
+// WithDependencies adds the services the selected services depend on, directly or through other services,
+// so they are built first. The names of the added services are returned in the order they were found
+func WithDependencies(selected []ServiceProject, all []ServiceProject) ([]ServiceProject, []string) {
+	byName := map[string]ServiceProject{}
+	for _, service := range all {
+		byName[service.Name()] = service
+	}
+
+	included := map[string]bool{}
+	for _, service := range selected {
+		included[service.Name()] = true
+	}
+
+	services := append([]ServiceProject{}, selected...)
+	added := []string{}
+
+	for i := 0; i < len(services); i++ {
+		for _, dependency := range services[i].DependsOn() {
+			dependencyService, ok := byName[dependency]
+			if !ok || included[dependency] {
+				continue
+			}
+
+			included[dependency] = true
+			services = append(services, dependencyService)
+			added = append(added, dependency)
+		}
+	}
+
+	return services, added
+}
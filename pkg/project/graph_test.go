@@ -0,0 +1,140 @@
+package project
+
+import (
+	"reflect"
+	"testing"
+)
+
+func serviceNames(services []ServiceProject) []string {
+	names := []string{}
+	for _, service := range services {
+		names = append(names, service.Name())
+	}
+	return names
+}
+
+func TestSortServices(t *testing.T) {
+	tests := []struct {
+		name     string
+		services map[string]string
+		expected []string
+		err      string
+	}{
+		{
+			name:     "without dependencies the order is kept",
+			services: map[string]string{"api": "", "base": "", "web": ""},
+			expected: []string{"api", "base", "web"},
+		},
+		{
+			name:     "dependencies come first",
+			services: map[string]string{"api": "[base]", "base": "", "web": "[api, base]"},
+			expected: []string{"base", "api", "web"},
+		},
+		{
+			name:     "transitive dependencies",
+			services: map[string]string{"api": "[lib]", "base": "", "lib": "[base]"},
+			expected: []string{"base", "lib", "api"},
+		},
+		{
+			name:     "unknown dependencies are ignored",
+			services: map[string]string{"api": "[missing]", "web": ""},
+			expected: []string{"api", "web"},
+		},
+		{
+			name:     "cycle",
+			services: map[string]string{"api": "[web]", "base": "", "web": "[worker]", "worker": "[api]"},
+			err:      "dependency cycle detected: api -> web -> worker -> api",
+		},
+		{
+			name:     "service depending on itself",
+			services: map[string]string{"api": "[api]"},
+			err:      "dependency cycle detected: api -> api",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			files := map[string]string{"kip_config.yaml": "template: project\nenvironment: dev\nversion: v0.0.0\n"}
+			for name, dependsOn := range test.services {
+				config := "template: service\nversion: v0.0.0\n"
+				if dependsOn != "" {
+					config += "dependsOn: " + dependsOn + "\n"
+				}
+				files["services/"+name+"/kip_config.yaml"] = config
+			}
+
+			p, cleanup := newTestProject(t, files, &FakeRunner{})
+			defer cleanup()
+
+			services, err := p.Services()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sorted, err := SortServices(services)
+
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Errorf("expected the error \"%s\", got %v", test.err, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if names := serviceNames(sorted); !reflect.DeepEqual(names, test.expected) {
+				t.Errorf("expected the order %v, got %v", test.expected, names)
+			}
+		})
+	}
+}
+
+func TestWithDependencies(t *testing.T) {
+	p, cleanup := newTestProject(t, map[string]string{
+		"kip_config.yaml":               "template: project\nenvironment: dev\nversion: v0.0.0\n",
+		"services/api/kip_config.yaml":  "template: service\nversion: v0.0.0\ndependsOn: [lib, missing]\n",
+		"services/base/kip_config.yaml": "template: service\nversion: v0.0.0\n",
+		"services/lib/kip_config.yaml":  "template: service\nversion: v0.0.0\ndependsOn: [base]\n",
+		"services/web/kip_config.yaml":  "template: service\nversion: v0.0.0\ndependsOn: [base]\n",
+	}, &FakeRunner{})
+	defer cleanup()
+
+	services, err := p.Services()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byName := map[string]ServiceProject{}
+	for _, service := range services {
+		byName[service.Name()] = service
+	}
+
+	tests := []struct {
+		selected []string
+		expected []string
+		added    []string
+	}{
+		{selected: []string{"base"}, expected: []string{"base"}, added: []string{}},
+		{selected: []string{"api"}, expected: []string{"api", "lib", "base"}, added: []string{"lib", "base"}},
+		{selected: []string{"web", "base"}, expected: []string{"web", "base"}, added: []string{}},
+		{selected: []string{"web", "api"}, expected: []string{"web", "api", "base", "lib"}, added: []string{"base", "lib"}},
+	}
+
+	for _, test := range tests {
+		selected := []ServiceProject{}
+		for _, name := range test.selected {
+			selected = append(selected, byName[name])
+		}
+
+		withDependencies, added := WithDependencies(selected, services)
+
+		if names := serviceNames(withDependencies); !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("expected %v for %v, got %v", test.expected, test.selected, names)
+		}
+		if !reflect.DeepEqual(added, test.added) {
+			t.Errorf("expected %v to be added for %v, got %v", test.added, test.selected, added)
+		}
+	}
+}
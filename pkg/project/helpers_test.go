@@ -0,0 +1,108 @@
+package project
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testImageID = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+// newTestProject writes the files to a temporary directory and loads it as project with the runner
+func newTestProject(t *testing.T, files map[string]string, runner Runner) (Project, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "kip-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	// the paths are compared with the ones kip resolves, which follows symlinks like /tmp on macOS
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+
+	root := filepath.Join(dir, "shop")
+
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+	}
+
+	p, err := Open(root, map[string]string{}, runner)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+
+	return p, cleanup
+}
+
+func testService(t *testing.T, p Project, name string) ServiceProject {
+	t.Helper()
+
+	services, err := p.Services()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, service := range services {
+		if service.Name() == name {
+			return service
+		}
+	}
+
+	t.Fatalf("service %s not found", name)
+	return ServiceProject{}
+}
+
+func testChart(t *testing.T, p Project, name string) Chart {
+	t.Helper()
+
+	charts, err := p.Charts()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, chart := range charts {
+		if chart.Name() == name {
+			return chart
+		}
+	}
+
+	t.Fatalf("chart %s not found", name)
+	return Chart{}
+}
+
+// assertCalls compares the name and arguments of the recorded commands
+func assertCalls(t *testing.T, runner *FakeRunner, expected [][]string) {
+	t.Helper()
+
+	calls := [][]string{}
+	for _, call := range runner.Calls() {
+		calls = append(calls, append([]string{call.Name}, call.Args...))
+	}
+
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("unexpected commands\nexpected:")
+		for _, call := range expected {
+			t.Errorf("  %q", call)
+		}
+		t.Errorf("got:")
+		for _, call := range calls {
+			t.Errorf("  %q", call)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultImageValuesPath is the values path the service images are written to
+const DefaultImageValuesPath = "global.services"
+
+// ServiceImage describes the built image of a service as passed to the charts
+type ServiceImage struct {
+	Repository string `yaml:"repository" json:"repository"`
+	Name       string `yaml:"name" json:"name"`
+	Tag        string `yaml:"tag" json:"tag"`
+	ImageID    string `yaml:"imageId" json:"imageId"`
+	Digest     string `yaml:"digest" json:"digest"`
+	Key        string `yaml:"key" json:"key"`
+	Image      string `yaml:"image" json:"-"`
+}
+
+// Reference returns the image reference, pinned to the registry digest once the image is pushed
+func (i ServiceImage) Reference() string {
+	if i.Digest != "" {
+		return i.Repository + i.Name + "@" + i.Digest
+	}
+	return i.Repository + i.Name + ":" + i.Tag
+}
+
+// scriptServiceImage returns the image a script set for the service with an image output
+func scriptServiceImage(service string, key string, reference string) ServiceImage {
+	image := ServiceImage{Name: service, Key: key, Image: reference}
+
+	name := reference
+	if i := strings.Index(name, "@"); i != -1 {
+		name, image.Digest = name[:i], name[i+1:]
+	}
+
+	name, image.Tag = splitImageTag(name)
+	if i := strings.LastIndex(name, "/"); i != -1 {
+		image.Repository = name[:i+1]
+	}
+
+	return image
+}
+
+// ValuesKey returns the key the service image is written with, helm does not allow dashes in keys
+func (i ServiceImage) ValuesKey() string {
+	return strings.ReplaceAll(i.Name, "-", "_")
+}
+
+// WriteImageValues writes a helm values file with the images nested under the values path
+func WriteImageValues(path string, valuesPath string, images []ServiceImage) error {
+	services := yaml.MapSlice{}
+	for _, image := range images {
+		if image.Image == "" {
+			image.Image = image.Reference()
+		}
+		services = append(services, yaml.MapItem{Key: image.ValuesKey(), Value: image})
+	}
+
+	var values interface{} = services
+
+	if valuesPath == "" {
+		valuesPath = DefaultImageValuesPath
+	}
+
+	keys := strings.Split(valuesPath, ".")
+	for i := len(keys) - 1; i >= 0; i-- {
+		values = yaml.MapSlice{{Key: keys[i], Value: values}}
+	}
+
+	content, err := yaml.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, content, 0644)
+}
+
+var imageRecordsMutex sync.Mutex
+
+func imageRecordsPath(root string) string {
+	return filepath.Join(root, ".kip", "images.json")
+}
+
+func imageRecordKey(environment string, service string, key string) string {
+	return fmt.Sprintf("%s/%s:%s", environment, service, key)
+}
+
+func readImageRecords(root string) (map[string]ServiceImage, error) {
+	records := map[string]ServiceImage{}
+
+	content, err := ioutil.ReadFile(imageRecordsPath(root))
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, &records); err != nil {
+		return nil, fmt.Errorf("unable to read %s: %v", imageRecordsPath(root), err)
+	}
+
+	return records, nil
+}
+
+// loadImageRecord returns the pushed image of a service for the build key
+func loadImageRecord(root string, environment string, service string, key string) (ServiceImage, bool) {
+	imageRecordsMutex.Lock()
+	defer imageRecordsMutex.Unlock()
+
+	records, err := readImageRecords(root)
+	if err != nil {
+		return ServiceImage{}, false
+	}
+
+	record, found := records[imageRecordKey(environment, service, key)]
+	return record, found
+}
+
+// saveImageRecord saves the pushed image so deploys in other jobs can use its digest
+func saveImageRecord(root string, environment string, image ServiceImage) error {
+	imageRecordsMutex.Lock()
+	defer imageRecordsMutex.Unlock()
+
+	records, err := readImageRecords(root)
+	if err != nil {
+		return err
+	}
+
+	records[imageRecordKey(environment, image.Name, image.Key)] = image
+
+	content, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(imageRecordsPath(root)), os.ModePerm); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(imageRecordsPath(root), content, 0644)
+}
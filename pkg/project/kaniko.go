@@ -0,0 +1,77 @@
+package project
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// kaniko builds and pushes in one step inside a container, there is no local image store. The
+// manifest digest is used as image ID. Only the destinations of the build are tags in the registry,
+// services pass their key as destination, other tags only exist in the digest store of the project
+type kaniko struct {
+	runner  Runner
+	digests digestStore
+}
+
+func (k kaniko) Build(build ImageBuild) ([]byte, error) {
+	cacheRepository, err := cacheRepository(build.Cache)
+	if err != nil {
+		return nil, err
+	}
+
+	digestFile, err := tempDigestFile()
+	if err != nil {
+		return nil, err
+	}
+
+	cmdArgs := []string{"--context", build.Context, "--dockerfile", filepath.Join(build.Context, build.Dockerfile), "--digest-file", digestFile}
+	for _, tag := range build.Tags {
+		cmdArgs = append(cmdArgs, "--destination", tag)
+	}
+	if cacheRepository != "" {
+		cmdArgs = append(cmdArgs, "--cache=true", "--cache-repo", cacheRepository)
+	}
+	cmdArgs = append(cmdArgs, build.Args...)
+
+	out, err := streamOutput(k.runner, Command{Name: BuilderCommand(BuilderKaniko), Args: cmdArgs, Dir: build.Context}, build.Output)
+	if err != nil {
+		os.Remove(digestFile)
+		return out, err
+	}
+
+	digest, err := readDigestFile(digestFile)
+	if err != nil {
+		return out, err
+	}
+
+	return out, k.digests.save(digest, build.Tags...)
+}
+
+func (k kaniko) ImageID(image string) (string, error) {
+	digest, ok := k.digests.get(image)
+	if !ok {
+		return "", fmt.Errorf("no image %s built by kaniko", image)
+	}
+	return digest, nil
+}
+
+func (k kaniko) RepoDigests(image string) ([]string, error) {
+	return k.digests.repoDigests(image)
+}
+
+// Tag records the tag in the digest store, kaniko can not tag images in the registry after the build
+func (k kaniko) Tag(source string, target string) error {
+	digest, ok := k.digests.get(source)
+	if !ok {
+		return fmt.Errorf("no image %s built by kaniko", source)
+	}
+	return k.digests.save(digest, target)
+}
+
+func (k kaniko) Push(image string, args []string) ([]byte, error) {
+	if _, ok := k.digests.get(image); !ok {
+		return nil, fmt.Errorf("no image %s built by kaniko", image)
+	}
+	return []byte(fmt.Sprintf("%s was pushed by kaniko while building\n", image)), nil
+}
@@ -0,0 +1,65 @@
+package project
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/joho/godotenv"
+	"github.com/spf13/viper"
+)
+
+// Find returns the closest directory from path upwards that contains a kip_config
+func Find(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		for _, name := range []string{"kip_config.yaml", "kip_config.yml"} {
+			if _, err := os.Stat(filepath.Join(path, name)); err == nil {
+				return path, nil
+			}
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", ErrProjectNotFound
+		}
+		path = parent
+	}
+}
+
+// Open reads the kip_config in root and creates the project with the given env and runner
+func Open(root string, env map[string]string, runner Runner) (Project, error) {
+	config := viper.New()
+	config.AddConfigPath(root)
+	config.SetConfigName("kip_config")
+	config.SetConfigType("yaml")
+
+	if err := config.ReadInConfig(); err != nil {
+		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
+			return nil, ErrProjectNotFound
+		}
+		return nil, &ConfigError{Path: filepath.Join(root, "kip_config.yaml"), Err: err}
+	}
+
+	p, err := NewProject(root, config, env, runner)
+	if err != nil {
+		return nil, &ConfigError{Path: config.ConfigFileUsed(), Err: err}
+	}
+
+	return p, nil
+}
+
+// Load finds the project containing path and opens it with the .env of its root
+func Load(path string) (Project, error) {
+	root, err := Find(path)
+	if err != nil {
+		return nil, err
+	}
+
+	env, _ := godotenv.Read(filepath.Join(root, ".env"))
+
+	return Open(root, env, ExecRunner{})
+}
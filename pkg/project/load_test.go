@@ -0,0 +1,86 @@
+package project
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+	p, cleanup := newTestProject(t, map[string]string{
+		"kip_config.yaml":                 "template: project\nversion: v0.0.0\n",
+		"services/web/src/index.js":       "",
+		"services/web/kip_config.yaml":    "template: service\nversion: v0.0.0\n",
+		"services/api/src/nested/main.go": "",
+	}, &FakeRunner{})
+	defer cleanup()
+
+	root := p.Paths().Root
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{path: root, expected: root},
+		{path: filepath.Join(root, "services", "web", "src"), expected: filepath.Join(root, "services", "web")},
+		{path: filepath.Join(root, "services", "api", "src", "nested"), expected: root},
+	}
+
+	for _, test := range tests {
+		found, err := Find(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != test.expected {
+			t.Errorf("expected %s for %s, got %s", test.expected, test.path, found)
+		}
+	}
+
+	if _, err := Find(filepath.Dir(root)); !errors.Is(err, ErrProjectNotFound) {
+		t.Errorf("expected ErrProjectNotFound outside of a project, got %v", err)
+	}
+}
+
+func TestOpenConfigError(t *testing.T) {
+	p, cleanup := newTestProject(t, map[string]string{
+		"kip_config.yaml":              "template: project\nversion: v0.0.0\n",
+		"services/web/kip_config.yaml": "template: service\nversion: [v0.0.0\n",
+	}, &FakeRunner{})
+	defer cleanup()
+
+	_, err := p.Services()
+
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) {
+		t.Fatalf("expected a ConfigError, got %v", err)
+	}
+
+	expected := filepath.Join(p.Paths().Root, "services", "web", "kip_config.yaml")
+	if configErr.Path != expected {
+		t.Errorf("expected the error for %s, got %s", expected, configErr.Path)
+	}
+
+	if _, err := Open(filepath.Join(p.Paths().Root, "services", "web"), map[string]string{}, &FakeRunner{}); !errors.As(err, &configErr) {
+		t.Errorf("expected Open to return a ConfigError, got %v", err)
+	}
+}
+
+func TestGetServiceNotFound(t *testing.T) {
+	p, cleanup := newTestProject(t, map[string]string{
+		"kip_config.yaml":              "template: project\nversion: v0.0.0\n",
+		"services/web/kip_config.yaml": "template: service\nversion: v0.0.0\n",
+	}, &FakeRunner{})
+	defer cleanup()
+
+	if _, err := p.GetService("web"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.GetService("api"); !errors.Is(err, ErrServiceNotFound) {
+		t.Errorf("expected ErrServiceNotFound, got %v", err)
+	}
+
+	if _, err := p.GetScript("lint"); !errors.Is(err, ErrScriptNotFound) {
+		t.Errorf("expected ErrScriptNotFound, got %v", err)
+	}
+}
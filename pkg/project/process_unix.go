@@ -0,0 +1,26 @@
+//go:build !windows
+// +build !windows
+
+package project
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// forwardedSignals are passed on to scripts running in their own process group
+var forwardedSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+
+// setProcessGroup starts the command in its own process group, so a timeout also stops what it started
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+func signalProcessGroup(cmd *exec.Cmd, sig os.Signal) error {
+	return syscall.Kill(-cmd.Process.Pid, sig.(syscall.Signal))
+}
@@ -0,0 +1,79 @@
+//go:build !windows
+// +build !windows
+
+package project
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestScriptCancel(t *testing.T) {
+	p, cleanup := newTestProject(t, map[string]string{
+		"kip_config.yaml": `template: project
+environment: dev
+version: v0.0.0
+scripts:
+  - name: attached
+    run: ps -o pgid= -p $$ > attached.pgid
+  - name: long
+    timeout: 1m
+    run: touch started; sleep 30
+`,
+	}, &FakeRunner{})
+	defer cleanup()
+
+	get := func(name string) *Script {
+		script, err := p.GetScript(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return script
+	}
+
+	// without a timeout the script stays in kip's process group and gets ctrl-c from the terminal
+	if err := get("attached").Run(ioutil.Discard, []string{}); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(p.Paths().Root, "attached.pgid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pgid, err := strconv.Atoi(strings.TrimSpace(string(content))); err != nil || pgid != syscall.Getpgrp() {
+		t.Errorf("expected the script in kip's process group %d, got %q", syscall.Getpgrp(), content)
+	}
+
+	var raised os.Signal
+	defer func(raise func(os.Signal)) { raiseSignal = raise }(raiseSignal)
+	raiseSignal = func(sig os.Signal) { raised = sig }
+
+	go func() {
+		started := filepath.Join(p.Paths().Root, "started")
+		for i := 0; i < 200; i++ {
+			if _, err := os.Stat(started); err == nil {
+				syscall.Kill(os.Getpid(), syscall.SIGINT)
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	start := time.Now()
+	if err := get("long").Run(ioutil.Discard, []string{}); err == nil || err.Error() != "stopped by interrupt" {
+		t.Errorf("expected the script to be interrupted, got %v", err)
+	}
+
+	// sh waits for the sleep, the run only returns this early when the whole group got the signal
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("expected the interrupt to stop the process group, the run took %s", elapsed)
+	}
+	if raised != syscall.SIGINT {
+		t.Errorf("expected kip to get the interrupt back, got %v", raised)
+	}
+}
@@ -0,0 +1,24 @@
+//go:build windows
+// +build windows
+
+package project
+
+import (
+	"os"
+	"os/exec"
+)
+
+// forwardedSignals are passed on to scripts running in their own process group
+var forwardedSignals = []os.Signal{os.Interrupt}
+
+// setProcessGroup is a no-op, windows has no process groups to signal
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+// signalProcessGroup kills the process, windows can't deliver an interrupt to it
+func signalProcessGroup(cmd *exec.Cmd, sig os.Signal) error {
+	return cmd.Process.Kill()
+}
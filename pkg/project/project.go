@@ -0,0 +1,438 @@
+package project
+
+import (
+	"debugged-dev/kip/v1/internal/version"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+	"robpike.io/filter"
+)
+
+// Project contains all the functions for maintaining a project
+type Project interface {
+	Name() string
+	Version() string
+	Template() string
+	Environment() string
+	Repository(enviroment string) (string, error)
+	DockerBuildArgs(enviroment string) []string
+	Namespace(environment string) string
+	KubeContext(environment string) string
+	HelmArgs(environment string) []string
+	WhitelistedContexts() []string
+	ImageValuesPath() string
+	StateStore(environment string) (StateStore, error)
+	Paths() paths
+	Charts() ([]Chart, error)
+	AddChart(chartName string, args []string) (string, error)
+	Services() ([]ServiceProject, error)
+	GetService(name string) (*ServiceProject, error)
+	GetScript(name string) (*Script, error)
+	GetScripts(binding string, environment string) ([]Script, error)
+	AddScript(name string, command string, bindings []string) error
+	AddScriptConfig(script Script) error
+	formatString(value string) string
+	formatStrings(values []string) []string
+	getEnv(value string) string
+	commandRunner() Runner
+}
+
+// MonoProject defined a project that contains multiple services
+type MonoProject struct {
+	path   string
+	config *viper.Viper
+	env    map[string]string
+	runner Runner
+}
+
+func CreateMonoProject(path string, name string) error {
+	project := MonoProject{path: filepath.Join(path, name)}
+	return project.New(name)
+}
+
+type paths struct {
+	Root              string
+	Services          string
+	Deployments       string
+	Environments      string
+	Scripts           string
+	Libraries         string
+	BuildPathTemplate string
+}
+
+type EnvConfig struct {
+	Repository      string       `mapstructure:"repository"`
+	DockerBuildArgs []string     `mapstructure:"dockerBuildArgs"`
+	Namespace       string       `mapstructure:"namespace"`
+	KubeContext     string       `mapstructure:"kubeContext"`
+	HelmArgs        []string     `mapstructure:"helmArgs"`
+	Builder         string       `mapstructure:"builder"`
+	Platforms       []string     `mapstructure:"platforms"`
+	Cache           *cacheConfig `mapstructure:"cache"`
+	Dockerfile      string       `mapstructure:"dockerfile"`
+	Target          string       `mapstructure:"target"`
+	Context         string       `mapstructure:"context"`
+}
+
+func (p MonoProject) Name() string {
+	return filepath.Base(p.path)
+}
+
+func (p MonoProject) Template() string {
+	return p.config.GetString("template")
+}
+
+func (p MonoProject) Environment() string {
+	return p.config.GetString("environment")
+}
+
+func (p MonoProject) EnvConfig() map[string]*EnvConfig {
+	envConfigs := make(map[string]*EnvConfig)
+	p.config.UnmarshalKey("environments", &envConfigs)
+	return envConfigs
+}
+
+func (p MonoProject) Repository(environment string) (string, error) {
+	configs := p.EnvConfig()
+	if val, ok := configs[environment]; ok && val.Repository != "" {
+		return p.formatString(val.Repository), nil
+	}
+	return p.formatString(p.config.GetString("repository")), nil
+}
+
+func (p MonoProject) DockerBuildArgs(environment string) []string {
+	configs := p.EnvConfig()
+	if val, ok := configs[environment]; ok && len(val.DockerBuildArgs) > 0 {
+		return p.formatStrings(val.DockerBuildArgs)
+	}
+	return p.formatStrings(p.config.GetStringSlice("dockerBuildArgs"))
+}
+
+// Namespace returns the kubernetes namespace charts are deployed to in the environment
+func (p MonoProject) Namespace(environment string) string {
+	configs := p.EnvConfig()
+	if val, ok := configs[environment]; ok && val.Namespace != "" {
+		return p.formatString(val.Namespace)
+	}
+	return p.formatString(p.config.GetString("namespace"))
+}
+
+// KubeContext returns the kubeconfig context used for the environment, empty for the current context
+func (p MonoProject) KubeContext(environment string) string {
+	configs := p.EnvConfig()
+	if val, ok := configs[environment]; ok && val.KubeContext != "" {
+		return p.formatString(val.KubeContext)
+	}
+	return p.formatString(p.config.GetString("kubeContext"))
+}
+
+// HelmArgs returns the extra arguments passed to helm in the environment
+func (p MonoProject) HelmArgs(environment string) []string {
+	configs := p.EnvConfig()
+	if val, ok := configs[environment]; ok && len(val.HelmArgs) > 0 {
+		return p.formatStrings(val.HelmArgs)
+	}
+	return p.formatStrings(p.config.GetStringSlice("helmArgs"))
+}
+
+// Target returns the Dockerfile stage services build in the environment, empty for the final stage
+func (p MonoProject) Target(environment string) string {
+	configs := p.EnvConfig()
+	if val, ok := configs[environment]; ok && val.Target != "" {
+		return val.Target
+	}
+	return p.config.GetString("target")
+}
+
+// dockerfile returns the Dockerfile the services are built from in the environment, relative to each service.
+// Empty when the project leaves it to the services
+func (p MonoProject) dockerfile(environment string) string {
+	configs := p.EnvConfig()
+	if val, ok := configs[environment]; ok && val.Dockerfile != "" {
+		return val.Dockerfile
+	}
+	return p.config.GetString("dockerfile")
+}
+
+// buildContext returns the build context of the services in the environment, relative to each service.
+// Empty when the project leaves it to the services
+func (p MonoProject) buildContext(environment string) string {
+	configs := p.EnvConfig()
+	if val, ok := configs[environment]; ok && val.Context != "" {
+		return val.Context
+	}
+	return p.config.GetString("context")
+}
+
+// Platforms returns the platforms images are built for in the environment, empty for the local platform
+func (p MonoProject) Platforms(environment string) []string {
+	configs := p.EnvConfig()
+	if val, ok := configs[environment]; ok && len(val.Platforms) > 0 {
+		return val.Platforms
+	}
+	return p.config.GetStringSlice("platforms")
+}
+
+// ImageValuesPath returns the values path the service images are written to
+func (p MonoProject) ImageValuesPath() string {
+	if p.config.IsSet("imageValuesPath") {
+		return p.config.GetString("imageValuesPath")
+	}
+	return DefaultImageValuesPath
+}
+
+// BuilderName returns the image builder of the environment, docker by default
+func (p MonoProject) BuilderName(environment string) string {
+	configs := p.EnvConfig()
+	if val, ok := configs[environment]; ok && val.Builder != "" {
+		return val.Builder
+	}
+	if p.config.IsSet("builder") {
+		return p.config.GetString("builder")
+	}
+	return BuilderDocker
+}
+
+// DockerBackend returns how the services talk to docker, cli or api
+func (p MonoProject) DockerBackend() string {
+	if p.config.IsSet("dockerBackend") {
+		return p.config.GetString("dockerBackend")
+	}
+	return DockerBackendCLI
+}
+
+func (p MonoProject) WhitelistedContexts() []string {
+	return p.config.GetStringSlice("whitelistedContexts")
+}
+
+func (p MonoProject) StateStore(environment string) (StateStore, error) {
+	config := stateConfig{}
+	if err := p.config.UnmarshalKey("state", &config); err != nil {
+		return nil, err
+	}
+	if config.Namespace == "" {
+		config.Namespace = p.Namespace(environment)
+	}
+	return newStateStore(config, p.Paths().Root, p.KubeContext(environment), p.commandRunner())
+}
+
+func (p MonoProject) commandRunner() Runner {
+	if p.runner == nil {
+		return ExecRunner{}
+	}
+	return p.runner
+}
+
+func (p MonoProject) Version() string {
+	return p.config.GetString("version")
+}
+
+func (p MonoProject) Paths() paths {
+	buildPathTemplate := "<serviceDir>"
+
+	if p.config != nil && p.config.IsSet("buildPath") && len(p.config.GetString("buildPath")) > 0 {
+		buildPathTemplate = p.config.GetString("buildPath")
+	}
+
+	return paths{
+		Root:              p.path,
+		Services:          filepath.Join(p.path, "services"),
+		Deployments:       filepath.Join(p.path, "deployments"),
+		Environments:      filepath.Join(p.path, "environments"),
+		Scripts:           filepath.Join(p.path, "scripts"),
+		Libraries:         filepath.Join(p.path, "libraries"),
+		BuildPathTemplate: buildPathTemplate,
+	}
+}
+
+func (p MonoProject) Services() ([]ServiceProject, error) {
+	return getServices(p.Paths().Services, &p)
+}
+
+func (p MonoProject) GetService(name string) (*ServiceProject, error) {
+	services, err := p.Services()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, service := range services {
+		if service.Name() == name {
+			return &service, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrServiceNotFound, name)
+}
+
+func (p MonoProject) Charts() ([]Chart, error) {
+	return getCharts(p.Paths().Deployments, p)
+}
+
+func (p MonoProject) AddChart(chartName string, args []string) (string, error) {
+	return createChart(p.commandRunner(), chartName, p.Paths().Deployments, args)
+}
+
+func (p MonoProject) GetScript(name string) (*Script, error) {
+	scripts, err := p.GetScripts("", "")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, script := range scripts {
+		if script.Name == name {
+			return &script, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrScriptNotFound, name)
+}
+
+func (p MonoProject) GetScripts(binding string, environment string) ([]Script, error) {
+	var scripts []Script
+	err := p.config.UnmarshalKey("scripts", &scripts)
+
+	if err != nil {
+		return nil, &ConfigError{Path: p.config.ConfigFileUsed(), Err: err}
+	}
+
+	scripts = filter.Apply(scripts, func(s Script) Script {
+		s.Path = p.Paths().Root
+		s.LegacyOutput = s.LegacyOutput || p.LegacyScriptOutput()
+		s.format = p.formatString
+		return s
+	}).([]Script)
+
+	if binding != "" {
+		scripts = filter.Choose(scripts, func(s Script) bool {
+			for _, value := range s.Bindings {
+				if value == binding {
+					return true
+				}
+			}
+			return false
+		}).([]Script)
+	}
+
+	if environment != "" {
+		scripts = filter.Choose(scripts, func(s Script) bool {
+
+			if len(s.Environments) == 0 {
+				return true
+			}
+
+			for _, value := range s.Environments {
+				if value == environment {
+					return true
+				}
+			}
+			return false
+		}).([]Script)
+	}
+
+	return scripts, nil
+}
+
+// LegacyScriptOutput returns whether scripts still set the KEY=VALUE lines they print as environment variables
+func (p MonoProject) LegacyScriptOutput() bool {
+	return p.config.GetBool("legacyScriptOutput")
+}
+
+// AddScript adds a script that runs command to the config
+func (p MonoProject) AddScript(name string, command string, bindings []string) error {
+	return p.AddScriptConfig(Script{Name: name, Command: command, Bindings: bindings})
+}
+
+// AddScriptConfig adds a script with all its settings, like run or needs, to the config
+func (p MonoProject) AddScriptConfig(script Script) error {
+	configs := []scriptConfig{}
+	if err := p.config.UnmarshalKey("scripts", &configs); err != nil {
+		return &ConfigError{Path: p.config.ConfigFileUsed(), Err: err}
+	}
+
+	scriptConfigs, err := addScript(configs, script)
+	if err != nil {
+		return err
+	}
+
+	p.config.Set("scripts", scriptConfigs)
+
+	return p.config.WriteConfig()
+}
+
+func (p MonoProject) New(name string) error {
+	paths := p.Paths()
+
+	if _, err := os.Stat(paths.Root); !os.IsNotExist(err) {
+		return fmt.Errorf("folder %s already exist", name)
+	}
+
+	os.MkdirAll(paths.Root, os.ModePerm)
+	os.MkdirAll(paths.Services, os.ModePerm)
+	os.MkdirAll(paths.Scripts, os.ModePerm)
+	os.MkdirAll(paths.Environments, os.ModePerm)
+	os.MkdirAll(paths.Deployments, os.ModePerm)
+
+	config := viper.New()
+	config.AddConfigPath(paths.Root)
+	config.SetConfigName("kip_config")
+	config.SetConfigType("yaml")
+
+	config.Set("template", "project")
+	config.Set("version", version.Get().Version)
+	config.Set("environment", "dev")
+
+	err := config.SafeWriteConfig()
+
+	if err != nil {
+		os.RemoveAll(paths.Root)
+		return err
+	}
+
+	return nil
+}
+
+func (p MonoProject) formatString(value string) string {
+	r := regexp.MustCompile(`\${[a-zA-Z_0-9]+}`)
+	matches := r.FindAllString(value, -1)
+	for _, match := range matches {
+		envName := match[2 : len(match)-1]
+		value = strings.ReplaceAll(value, match, p.getEnv(envName))
+	}
+	return value
+}
+
+func (p MonoProject) formatStrings(values []string) []string {
+	for i, value := range values {
+		values[i] = p.formatString(value)
+	}
+	return values
+}
+
+func (p MonoProject) getEnv(key string) string {
+	value := p.env[key]
+	if value == "" {
+		value = os.Getenv(key)
+	}
+	return value
+}
+
+// GetProject creates the project class and makes it globally Available
+func GetProject(projectPath string, config *viper.Viper, env map[string]string) (Project, error) {
+	return NewProject(projectPath, config, env, ExecRunner{})
+}
+
+// NewProject creates the project with the runner used for docker, helm and kubectl
+func NewProject(projectPath string, config *viper.Viper, env map[string]string, runner Runner) (Project, error) {
+	switch config.GetString("template") {
+	case "project":
+		return MonoProject{path: projectPath, config: config, env: env, runner: runner}, nil
+	case "service":
+		return ServiceProject{path: projectPath, config: config, env: &env, runner: runner}, nil
+	default:
+		return nil, fmt.Errorf("template %s not implemented", config.GetString("template"))
+	}
+}
@@ -0,0 +1,67 @@
+package project
+
+import (
+	"bytes"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// Command is an external command like docker, helm or kubectl
+type Command struct {
+	Name   string
+	Args   []string
+	Dir    string
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+func (c Command) String() string {
+	return strings.Join(append([]string{c.Name}, c.Args...), " ")
+}
+
+// Runner runs the external commands of a project
+type Runner interface {
+	Run(cmd Command) error
+}
+
+// ExecRunner runs commands as child processes
+type ExecRunner struct{}
+
+func (ExecRunner) Run(c Command) error {
+	cmd := exec.Command(c.Name, c.Args...)
+	cmd.Dir = c.Dir
+	cmd.Stdin = c.Stdin
+	cmd.Stdout = c.Stdout
+	cmd.Stderr = c.Stderr
+	return cmd.Run()
+}
+
+// output runs the command and returns what it wrote to stdout
+func output(r Runner, c Command) ([]byte, error) {
+	var stdout bytes.Buffer
+	c.Stdout = &stdout
+	err := r.Run(c)
+	return stdout.Bytes(), err
+}
+
+// streamOutput writes what the command writes to stdout and stderr to out, the output is returned when out is nil
+func streamOutput(r Runner, c Command, out io.Writer) ([]byte, error) {
+	if out == nil {
+		return combinedOutput(r, c)
+	}
+
+	c.Stdout = out
+	c.Stderr = out
+	return nil, r.Run(c)
+}
+
+// combinedOutput runs the command and returns what it wrote to stdout and stderr
+func combinedOutput(r Runner, c Command) ([]byte, error) {
+	var out bytes.Buffer
+	c.Stdout = &out
+	c.Stderr = &out
+	err := r.Run(c)
+	return out.Bytes(), err
+}
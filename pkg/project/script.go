@@ -0,0 +1,287 @@
+package project
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultShell runs the inline scripts of the run field
+const DefaultShell = "sh -c"
+
+// scriptConfig is how a script is written to kip_config.yaml
+type scriptConfig struct {
+	Name            string            `yaml:"name"`
+	Command         string            `yaml:"command,omitempty"`
+	Run             string            `yaml:"run,omitempty"`
+	Shell           string            `yaml:"shell,omitempty"`
+	Workdir         string            `yaml:"workdir,omitempty"`
+	Env             map[string]string `yaml:"env,omitempty"`
+	Bindings        []string          `yaml:"bindings"`
+	Args            []string          `yaml:"args,omitempty"`
+	Environments    []string          `yaml:"environments,omitempty"`
+	Needs           []string          `yaml:"needs,omitempty"`
+	Steps           []string          `yaml:"steps,omitempty"`
+	Timeout         string            `yaml:"timeout,omitempty"`
+	Retries         int               `yaml:"retries,omitempty"`
+	RetryDelay      string            `yaml:"retryDelay,omitempty"`
+	ContinueOnError bool              `yaml:"continueOnError,omitempty"`
+	LegacyOutput    bool              `yaml:"legacyOutput,omitempty"`
+}
+
+type Script struct {
+	Name    string
+	Command string
+	// Inline is the run field, a script run with the shell instead of the command
+	Inline string `mapstructure:"run"`
+	// Shell runs the inline script, sh -c by default
+	Shell string
+	Path  string
+	// Workdir is the directory the script runs in, relative to the project or service
+	Workdir      string
+	Env          map[string]string
+	Bindings     []string
+	Args         []string
+	Environments []string
+	// Needs are the scripts that have to run before this script
+	Needs []string
+	// Steps are the scripts a composite script runs
+	Steps []string
+	// Timeout stops the script and everything it started, 0 runs it without a timeout
+	Timeout time.Duration
+	// Retries is how often a failed script runs again, RetryDelay is the time in between
+	Retries    int
+	RetryDelay time.Duration `mapstructure:"retryDelay"`
+	// ContinueOnError only warns when the script failed
+	ContinueOnError bool `mapstructure:"continueOnError"`
+	// LegacyOutput sets every KEY=VALUE line the script prints on stdout as environment variable
+	LegacyOutput bool `mapstructure:"legacyOutput"`
+
+	// format fills in the ${VAR} placeholders of the env values like the rest of the config
+	format func(string) string
+}
+
+func newScriptConfig(s Script) scriptConfig {
+	return scriptConfig{
+		Name:            s.Name,
+		Command:         s.Command,
+		Run:             s.Inline,
+		Shell:           s.Shell,
+		Workdir:         s.Workdir,
+		Env:             s.Env,
+		Bindings:        s.Bindings,
+		Args:            s.Args,
+		Environments:    s.Environments,
+		Needs:           s.Needs,
+		Steps:           s.Steps,
+		Timeout:         durationString(s.Timeout),
+		Retries:         s.Retries,
+		RetryDelay:      durationString(s.RetryDelay),
+		ContinueOnError: s.ContinueOnError,
+		LegacyOutput:    s.LegacyOutput,
+	}
+}
+
+func durationString(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// addScript returns the script configs with the new script appended, as the generic values viper
+// reads from kip_config.yaml so the unset fields are left out
+func addScript(configs []scriptConfig, script Script) ([]interface{}, error) {
+	if script.Command == "" && script.Inline == "" && len(script.Steps) == 0 {
+		return nil, fmt.Errorf("script \"%s\" needs a command, run or steps", script.Name)
+	}
+
+	for _, config := range configs {
+		if config.Name == script.Name {
+			return nil, fmt.Errorf("script \"%s\" already exists", script.Name)
+		}
+	}
+
+	content, err := yaml.Marshal(append(configs, newScriptConfig(script)))
+	if err != nil {
+		return nil, err
+	}
+
+	values := []interface{}{}
+	err = yaml.Unmarshal(content, &values)
+	return values, err
+}
+
+// ShellCommand returns the shell an inline script runs with
+func (s Script) ShellCommand() []string {
+	if shell := strings.Fields(s.Shell); len(shell) > 0 {
+		return shell
+	}
+	return strings.Fields(DefaultShell)
+}
+
+// Dir returns the directory the script runs in
+func (s Script) Dir() string {
+	if s.Workdir == "" {
+		return s.Path
+	}
+	if filepath.IsAbs(s.Workdir) {
+		return s.Workdir
+	}
+	return filepath.Join(s.Path, s.Workdir)
+}
+
+// Environ returns the environment of the script, the env of the config on top of the environment of kip
+func (s Script) Environ() []string {
+	environ := os.Environ()
+	for key, value := range s.Env {
+		if s.format != nil {
+			value = s.format(value)
+		}
+		environ = append(environ, key+"="+value)
+	}
+	return environ
+}
+
+// command returns the command of the script, inline scripts get the name as $0 and the args as $1...
+func (s Script) command(args []string) *exec.Cmd {
+	cmdArgs := append(append([]string{}, s.Args...), args...)
+
+	if s.Inline == "" {
+		return exec.Command(s.Command, cmdArgs...)
+	}
+
+	shell := s.ShellCommand()
+	shellArgs := append(append(shell[1:], s.Inline, s.Name), cmdArgs...)
+	return exec.Command(shell[0], shellArgs...)
+}
+
+// Run runs the script and retries it when it failed, the outputs it writes to the file in KIP_OUTPUT
+// are applied when it succeeds
+func (s Script) Run(out io.Writer, args []string) error {
+	return s.RunOutput(out, os.Stderr, args)
+}
+
+// RunOutput runs the script like Run and writes its stderr to stderr instead of the stderr of kip
+func (s Script) RunOutput(out io.Writer, stderr io.Writer, args []string) error {
+	if s.Command == "" && s.Inline == "" {
+		return fmt.Errorf("script \"%s\" has no command or run, run its steps with kip run", s.Name)
+	}
+
+	var err error
+
+	for attempt := 0; attempt <= s.Retries; attempt++ {
+		if attempt > 0 {
+			fmt.Fprintf(out, "RETRY script \"%s\" (%d/%d) in %s: %v\n", s.Name, attempt, s.Retries, s.RetryDelay, err)
+			time.Sleep(s.RetryDelay)
+		}
+
+		if err = s.run(out, stderr, args); err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+func (s Script) run(out io.Writer, stderr io.Writer, args []string) error {
+	outputFile, err := ioutil.TempFile("", "kip-output-")
+	if err != nil {
+		return err
+	}
+	outputFile.Close()
+	defer os.Remove(outputFile.Name())
+
+	cmd := s.command(args)
+	cmd.Dir = s.Dir()
+	cmd.Env = append(s.Environ(), ScriptOutputEnv+"="+outputFile.Name())
+	cmd.Stderr = stderr
+	if s.Timeout > 0 {
+		// only scripts with a timeout leave kip's process group, everything else still gets ctrl-c from the terminal
+		setProcessGroup(cmd)
+	}
+
+	var stdBuffer bytes.Buffer
+	cmd.Stdout = out
+	if s.LegacyOutput {
+		cmd.Stdout = io.MultiWriter(out, &stdBuffer)
+	}
+
+	err = s.wait(cmd)
+
+	if err != nil {
+		return err
+	}
+
+	outputs, err := parseScriptOutput(outputFile.Name())
+	if err != nil {
+		return err
+	}
+
+	if err := applyScriptOutputs(outputs); err != nil {
+		return err
+	}
+
+	if s.LegacyOutput {
+		applyLegacyOutput(stdBuffer.String())
+	}
+
+	return nil
+}
+
+// wait runs the command until it exits, after the timeout its process group is killed
+func (s Script) wait(cmd *exec.Cmd) error {
+	ctx := context.Background()
+	signals := make(chan os.Signal, 1)
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+
+		// the script's process group doesn't get the terminal's signals, catch them to pass them on
+		signal.Notify(signals, forwardedSignals...)
+		defer signal.Stop(signals)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case sig := <-signals:
+		signalProcessGroup(cmd, sig)
+		<-done
+		signal.Stop(signals)
+		raiseSignal(sig)
+		return fmt.Errorf("stopped by %s", sig)
+	case <-ctx.Done():
+		killProcessGroup(cmd)
+		<-done
+		return fmt.Errorf("timed out after %s", s.Timeout)
+	}
+}
+
+// raiseSignal sends a forwarded signal to kip itself once the script has stopped, so kip exits like the script did
+var raiseSignal = func(sig os.Signal) {
+	RemoveScriptValues()
+	if process, err := os.FindProcess(os.Getpid()); err == nil {
+		process.Signal(sig)
+	}
+}
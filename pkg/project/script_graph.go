@@ -0,0 +1,194 @@
+package project
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ScriptNode is a script in the graph of a run. Needs are the IDs of the nodes that have to finish first
+type ScriptNode struct {
+	// ID is the name of the script, service:name for the scripts of a service in a project
+	ID     string
+	Script Script
+	Needs  []string
+}
+
+// Composite reports if the node only groups its steps and has nothing to run itself
+func (n ScriptNode) Composite() bool {
+	return n.Script.Command == "" && n.Script.Inline == "" && len(n.Script.Steps) > 0
+}
+
+// ResolveScripts returns the scripts with everything they need and their steps, every script comes
+// after the scripts it needs. References are resolved in the scope of the script that makes them,
+// service:name references a script of a service and :name a script of the project
+func ResolveScripts(p Project, names ...string) ([]ScriptNode, error) {
+	scripts := map[string]Script{}
+	needs := map[string][]string{}
+	order := []string{}
+
+	var collect func(scope Project, ref string) (string, error)
+	collect = func(scope Project, ref string) (string, error) {
+		scope, script, err := resolveScriptRef(scope, ref)
+		if err != nil {
+			return "", err
+		}
+
+		id := scriptID(scope, script.Name)
+		if _, ok := scripts[id]; ok {
+			return id, nil
+		}
+
+		scripts[id] = script
+		order = append(order, id)
+
+		scriptNeeds := []string{}
+		for _, need := range script.Needs {
+			needID, err := collect(scope, need)
+			if err != nil {
+				return "", err
+			}
+			scriptNeeds = append(scriptNeeds, needID)
+		}
+
+		// the steps run after the needs of the composite script, which finishes after its steps
+		steps := []string{}
+		for _, step := range script.Steps {
+			stepID, err := collect(scope, step)
+			if err != nil {
+				return "", err
+			}
+			needs[stepID] = append(needs[stepID], scriptNeeds...)
+			steps = append(steps, stepID)
+		}
+
+		needs[id] = append(append(needs[id], scriptNeeds...), steps...)
+
+		return id, nil
+	}
+
+	for _, name := range names {
+		if _, err := collect(p, name); err != nil {
+			return nil, err
+		}
+	}
+
+	nodes := []ScriptNode{}
+	visited := map[string]bool{}
+	visiting := map[string]bool{}
+	path := []string{}
+
+	var visit func(id string) error
+	visit = func(id string) error {
+		if visited[id] {
+			return nil
+		}
+
+		path = append(path, id)
+
+		if visiting[id] {
+			start := 0
+			for i, p := range path {
+				if p == id {
+					start = i
+					break
+				}
+			}
+			return fmt.Errorf("script cycle detected: %s", strings.Join(path[start:], " -> "))
+		}
+
+		visiting[id] = true
+
+		for _, need := range needs[id] {
+			if err := visit(need); err != nil {
+				return err
+			}
+		}
+
+		visiting[id] = false
+		visited[id] = true
+		path = path[:len(path)-1]
+		nodes = append(nodes, ScriptNode{ID: id, Script: scripts[id], Needs: uniqueStrings(needs[id])})
+
+		return nil
+	}
+
+	for _, id := range order {
+		if err := visit(id); err != nil {
+			return nil, err
+		}
+	}
+
+	return nodes, nil
+}
+
+// resolveScriptRef returns the script a reference points to and the project or service it belongs to
+func resolveScriptRef(scope Project, ref string) (Project, Script, error) {
+	if parts := strings.SplitN(ref, ":", 2); len(parts) == 2 {
+		root := rootProject(scope)
+
+		if parts[0] == "" {
+			scope = root
+		} else {
+			if root.Template() != "project" {
+				return nil, Script{}, fmt.Errorf("script \"%s\" references a service outside of a project", ref)
+			}
+
+			service, err := root.GetService(parts[0])
+			if err != nil {
+				return nil, Script{}, err
+			}
+			scope = *service
+		}
+
+		ref = parts[1]
+	}
+
+	script, err := scope.GetScript(ref)
+	if err != nil {
+		return nil, Script{}, err
+	}
+
+	if script.Command == "" && script.Inline == "" && len(script.Steps) == 0 {
+		return nil, Script{}, fmt.Errorf("script \"%s\" needs a command, run or steps", ref)
+	}
+
+	return scope, *script, nil
+}
+
+// serviceInProject returns the service when p is a service of a project
+func serviceInProject(p Project) (ServiceProject, bool) {
+	switch service := p.(type) {
+	case ServiceProject:
+		return service, service.project != nil
+	case *ServiceProject:
+		return *service, service.project != nil
+	}
+	return ServiceProject{}, false
+}
+
+// rootProject returns the project a service belongs to
+func rootProject(p Project) Project {
+	if service, ok := serviceInProject(p); ok {
+		return *service.project
+	}
+	return p
+}
+
+func scriptID(scope Project, name string) string {
+	if service, ok := serviceInProject(scope); ok {
+		return service.Name() + ":" + name
+	}
+	return name
+}
+
+func uniqueStrings(values []string) []string {
+	unique := []string{}
+	seen := map[string]bool{}
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
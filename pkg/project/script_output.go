@@ -0,0 +1,270 @@
+package project
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// ScriptOutputEnv is the variable holding the path of the file scripts write their outputs to
+	ScriptOutputEnv = "KIP_OUTPUT"
+
+	// OutputEnv sets an environment variable for kip and the scripts that run after it, env NAME=value
+	OutputEnv = "env"
+	// OutputHelmArg adds an argument to every helm command, helm-arg --atomic
+	OutputHelmArg = "helm-arg"
+	// OutputHelmValue sets a helm value of every chart, helm-value ingress.host=example.com
+	OutputHelmValue = "helm-value"
+	// OutputImage overrides the image deployed for a service, image api=registry.example.com/api:1.2.3
+	OutputImage = "image"
+)
+
+// ScriptOutputs are the outputs the scripts of this kip process wrote to KIP_OUTPUT
+type ScriptOutputs struct {
+	Env        map[string]string
+	HelmArgs   []string
+	HelmValues map[string]interface{}
+	Images     map[string]string
+}
+
+var (
+	scriptOutputsMutex sync.Mutex
+	scriptOutputs      = newScriptOutputs()
+	scriptValuesPath   string
+)
+
+func newScriptOutputs() ScriptOutputs {
+	return ScriptOutputs{Env: map[string]string{}, HelmArgs: []string{}, HelmValues: map[string]interface{}{}, Images: map[string]string{}}
+}
+
+// GetScriptOutputs returns a copy of the outputs scripts wrote so far
+func GetScriptOutputs() ScriptOutputs {
+	scriptOutputsMutex.Lock()
+	defer scriptOutputsMutex.Unlock()
+
+	outputs := newScriptOutputs()
+	outputs.HelmArgs = append(outputs.HelmArgs, scriptOutputs.HelmArgs...)
+	for key, value := range scriptOutputs.Env {
+		outputs.Env[key] = value
+	}
+	for key, value := range scriptOutputs.HelmValues {
+		outputs.HelmValues[key] = value
+	}
+	for key, value := range scriptOutputs.Images {
+		outputs.Images[key] = value
+	}
+
+	return outputs
+}
+
+// ResetScriptOutputs forgets the outputs of earlier scripts
+func ResetScriptOutputs() {
+	scriptOutputsMutex.Lock()
+	defer scriptOutputsMutex.Unlock()
+
+	scriptOutputs = newScriptOutputs()
+	removeScriptValues()
+}
+
+// RemoveScriptValues deletes the values file of the script outputs, kip calls it before it exits
+func RemoveScriptValues() {
+	scriptOutputsMutex.Lock()
+	defer scriptOutputsMutex.Unlock()
+
+	removeScriptValues()
+}
+
+func removeScriptValues() {
+	if scriptValuesPath != "" {
+		os.Remove(scriptValuesPath)
+		scriptValuesPath = ""
+	}
+}
+
+// parseScriptOutput reads an output file, every line is a type followed by its value:
+//
+//	env NAME=value
+//	helm-arg --atomic
+//	helm-value ingress.host=example.com
+//	image api=registry.example.com/api:1.2.3
+func parseScriptOutput(path string) (ScriptOutputs, error) {
+	outputs := newScriptOutputs()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return outputs, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(entry, " ", 2)
+		if len(parts) != 2 {
+			return outputs, fmt.Errorf("%s:%d: expected \"<type> <value>\", got \"%s\"", path, line, entry)
+		}
+
+		kind, value := parts[0], strings.TrimSpace(parts[1])
+
+		// the value is split on whitespace like KIP_HELM_ARGS, helm-arg --timeout 10m adds two arguments
+		if kind == OutputHelmArg {
+			outputs.HelmArgs = append(outputs.HelmArgs, strings.Fields(value)...)
+			continue
+		}
+
+		pair := strings.SplitN(value, "=", 2)
+		if len(pair) != 2 || pair[0] == "" {
+			return outputs, fmt.Errorf("%s:%d: expected \"%s <key>=<value>\", got \"%s\"", path, line, kind, entry)
+		}
+
+		switch kind {
+		case OutputEnv:
+			outputs.Env[pair[0]] = pair[1]
+		case OutputHelmValue:
+			outputs.HelmValues[pair[0]] = typeHelmValue(pair[1])
+		case OutputImage:
+			outputs.Images[pair[0]] = pair[1]
+		default:
+			return outputs, fmt.Errorf("%s:%d: unknown output type \"%s\", use %s, %s, %s or %s", path, line, kind, OutputEnv, OutputHelmArg, OutputHelmValue, OutputImage)
+		}
+	}
+
+	return outputs, scanner.Err()
+}
+
+// typeHelmValue types a value the way helm --set does, true and false are booleans and integers without a
+// leading zero are numbers, everything else like on, 1.5 or 0123 stays a string
+func typeHelmValue(value string) interface{} {
+	switch value {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+
+	if value == "0" || (!strings.HasPrefix(value, "0") && !strings.HasPrefix(value, "-0")) {
+		if number, err := strconv.Atoi(value); err == nil {
+			return number
+		}
+	}
+
+	return value
+}
+
+// applyScriptOutputs makes the outputs of a script visible to the scripts and deploys that follow
+func applyScriptOutputs(outputs ScriptOutputs) error {
+	scriptOutputsMutex.Lock()
+	defer scriptOutputsMutex.Unlock()
+
+	for key, value := range outputs.Env {
+		scriptOutputs.Env[key] = value
+		if err := os.Setenv(key, value); err != nil {
+			return err
+		}
+	}
+
+	scriptOutputs.HelmArgs = append(scriptOutputs.HelmArgs, outputs.HelmArgs...)
+
+	for key, value := range outputs.Images {
+		scriptOutputs.Images[key] = value
+	}
+
+	if len(outputs.HelmValues) == 0 {
+		return nil
+	}
+
+	for key, value := range outputs.HelmValues {
+		scriptOutputs.HelmValues[key] = value
+	}
+
+	return writeScriptValues()
+}
+
+// writeScriptValues writes the helm values of all scripts to the values file passed to helm, every kip
+// process has its own file so parallel runs don't deploy each other's values
+func writeScriptValues() error {
+	values := map[interface{}]interface{}{}
+
+	for key, value := range scriptOutputs.HelmValues {
+		keys := strings.Split(key, ".")
+		parent := values
+		for _, k := range keys[:len(keys)-1] {
+			child, ok := parent[k].(map[interface{}]interface{})
+			if !ok {
+				child = map[interface{}]interface{}{}
+				parent[k] = child
+			}
+			parent = child
+		}
+		parent[keys[len(keys)-1]] = value
+	}
+
+	content, err := yaml.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	if scriptValuesPath == "" {
+		f, err := ioutil.TempFile("", "kip-script-values-*.yaml")
+		if err != nil {
+			return err
+		}
+		f.Close()
+		scriptValuesPath = f.Name()
+	}
+
+	return ioutil.WriteFile(scriptValuesPath, content, 0644)
+}
+
+// scriptHelmArgs returns the helm args and values file of the script outputs
+func scriptHelmArgs() []string {
+	scriptOutputsMutex.Lock()
+	defer scriptOutputsMutex.Unlock()
+
+	args := append([]string{}, scriptOutputs.HelmArgs...)
+	if len(scriptOutputs.HelmValues) > 0 && scriptValuesPath != "" {
+		args = append(args, "-f", scriptValuesPath)
+	}
+
+	return args
+}
+
+// scriptImage returns the image a script set for the service
+func scriptImage(service string) (string, bool) {
+	scriptOutputsMutex.Lock()
+	defer scriptOutputsMutex.Unlock()
+
+	image, ok := scriptOutputs.Images[service]
+	return image, ok
+}
+
+var legacyOutputLine = regexp.MustCompile(`^(?P<key>[A-z0-9]*)(=)(?P<value>.*)$`)
+
+// applyLegacyOutput sets every KEY=VALUE line a script printed as environment variable, KIP_HELM_ARGS is appended to
+func applyLegacyOutput(stdout string) {
+	for _, line := range strings.Split(stdout, "\n") {
+		if legacyOutputLine.MatchString(line) {
+			matches := legacyOutputLine.FindStringSubmatch(line)
+
+			if matches[1] == "KIP_HELM_ARGS" {
+				os.Setenv("KIP_HELM_ARGS", fmt.Sprintf("%s %s", os.Getenv("KIP_HELM_ARGS"), matches[3]))
+			} else {
+				os.Setenv(matches[1], matches[3])
+			}
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package project
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestScriptOutput(t *testing.T) {
+	defer unsetHelmArgs()()
+	defer ResetScriptOutputs()
+	defer os.Unsetenv("KIP_TEST_OUTPUT")
+	defer os.Unsetenv("KIP_TEST_LEGACY")
+
+	p, cleanup := newTestProject(t, map[string]string{
+		"kip_config.yaml": `template: project
+environment: dev
+version: v0.0.0
+scripts:
+  - name: outputs
+    command: sh
+    args:
+      - -c
+      - |
+        echo KIP_TEST_LEGACY=1
+        cat >> "$KIP_OUTPUT" <<OUT
+        # outputs of the test script
+        env KIP_TEST_OUTPUT=a=b
+        helm-arg --atomic
+        helm-arg --timeout  10m
+        helm-value ingress.host=example.com
+        helm-value replicas=3
+        helm-value tls=on
+        helm-value zip=0123
+        helm-value debug=false
+        image api=registry.example.com/api:1.2.3
+        OUT
+  - name: legacy
+    command: sh
+    legacyOutput: true
+    args: [-c, "echo KIP_TEST_LEGACY=1"]
+  - name: invalid
+    command: sh
+    args: [-c, "echo 'secret KEY=value' >> \"$KIP_OUTPUT\""]
+`,
+		"services/api/kip_config.yaml": "template: service\nversion: v0.0.0\n",
+		"deployments/web/Chart.yaml":   "name: web\n",
+	}, &FakeRunner{})
+	defer cleanup()
+
+	run := func(name string) error {
+		script, err := p.GetScript(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return script.Run(ioutil.Discard, []string{})
+	}
+
+	if err := run("outputs"); err != nil {
+		t.Fatal(err)
+	}
+
+	if value := os.Getenv("KIP_TEST_OUTPUT"); value != "a=b" {
+		t.Errorf("expected the env output to be set, got \"%s\"", value)
+	}
+
+	if _, set := os.LookupEnv("KIP_TEST_LEGACY"); set {
+		t.Error("expected stdout to be ignored without legacyOutput")
+	}
+
+	outputs := GetScriptOutputs()
+	expected := map[string]interface{}{"ingress.host": "example.com", "replicas": 3, "tls": "on", "zip": "0123", "debug": false}
+	if !reflect.DeepEqual(outputs.HelmValues, expected) {
+		t.Errorf("expected the helm values %v, got %v", expected, outputs.HelmValues)
+	}
+
+	args, err := getCommandArgsAndFiles(testChart(t, p, "web"), "dev", []string{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(args) != 8 || !reflect.DeepEqual(args[3:7], []string{"--atomic", "--timeout", "10m", "-f"}) {
+		t.Fatalf("expected the script helm args and values file, got %v", args)
+	}
+
+	if filepath.Dir(args[7]) != filepath.Clean(os.TempDir()) {
+		t.Errorf("expected a values file of this process in the temp dir, got %s", args[7])
+	}
+
+	values, err := ioutil.ReadFile(args[7])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(values) != "debug: false\ningress:\n  host: example.com\nreplicas: 3\ntls: \"on\"\nzip: \"0123\"\n" {
+		t.Errorf("unexpected script values\n%s", values)
+	}
+
+	RemoveScriptValues()
+	if _, err := os.Stat(args[7]); !os.IsNotExist(err) {
+		t.Errorf("expected the values file to be removed, got %v", err)
+	}
+
+	image, err := testService(t, p, "api").Image("", "latest", "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if image.Image != "registry.example.com/api:1.2.3" || image.Repository != "registry.example.com/" || image.Tag != "1.2.3" {
+		t.Errorf("expected the image output to override the built image, got %+v", image)
+	}
+
+	if err := run("legacy"); err != nil {
+		t.Fatal(err)
+	}
+
+	if value := os.Getenv("KIP_TEST_LEGACY"); value != "1" {
+		t.Errorf("expected legacyOutput to set the printed variable, got \"%s\"", value)
+	}
+
+	if err := run("invalid"); err == nil {
+		t.Error("expected an unknown output type to fail the script")
+	}
+}
+
+func TestInlineScript(t *testing.T) {
+	defer ResetScriptOutputs()
+	defer os.Unsetenv("KIP_TEST_HOST")
+	os.Setenv("KIP_TEST_HOST", "db.local")
+
+	p, cleanup := newTestProject(t, map[string]string{
+		"kip_config.yaml": `template: project
+environment: dev
+version: v0.0.0
+scripts:
+  - name: inline
+    shell: sh -ec
+    workdir: tools
+    env:
+      DATABASE_URL: postgres://${KIP_TEST_HOST}/shop
+    args: [first]
+    run: |
+      test "$(basename "$PWD")" = tools
+      echo "env INLINE_RESULT=$0 $1 $2 $DATABASE_URL" >> "$KIP_OUTPUT"
+`,
+		"tools/.keep": "",
+	}, &FakeRunner{})
+	defer cleanup()
+	defer os.Unsetenv("INLINE_RESULT")
+
+	script, err := p.GetScript("inline")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := script.Run(ioutil.Discard, []string{"second"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if result := os.Getenv("INLINE_RESULT"); result != "inline first second postgres://db.local/shop" {
+		t.Errorf("unexpected result of the inline script \"%s\"", result)
+	}
+
+	if err := p.AddScriptConfig(Script{Name: "seed", Inline: "npm run seed", Bindings: []string{"post-deploy"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.AddScript("seed", "./seed.sh", []string{}); err == nil {
+		t.Error("expected adding an existing script to fail")
+	}
+
+	if err := p.AddScript("migrate", "./migrate.sh", []string{"pre-deploy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if script, err := p.GetScript("migrate"); err != nil || script.Command != "./migrate.sh" || !reflect.DeepEqual(script.Bindings, []string{"pre-deploy"}) {
+		t.Errorf("expected the added command script, got %+v, %v", script, err)
+	}
+
+	scripts, err := p.GetScripts("post-deploy", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(scripts) != 1 || scripts[0].Inline != "npm run seed" {
+		t.Fatalf("expected the added inline script, got %+v", scripts)
+	}
+
+	// the existing scripts keep their settings when the config is rewritten
+	script, err = p.GetScript("inline")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if script.Workdir != "tools" || script.Env["DATABASE_URL"] == "" || len(script.Args) != 1 {
+		t.Errorf("expected the inline script to be unchanged, got %+v", script)
+	}
+}
+
+func TestResolveScripts(t *testing.T) {
+	p, cleanup := newTestProject(t, map[string]string{
+		"kip_config.yaml": `template: project
+environment: dev
+version: v0.0.0
+scripts:
+  - name: setup
+    run: echo setup
+  - name: lint
+    needs: [setup]
+    run: echo lint
+  - name: test
+    needs: [setup]
+    run: echo test
+  - name: ci
+    needs: [install]
+    steps: [lint, test, "api:check"]
+  - name: install
+    run: echo install
+  - name: loop
+    needs: [loop]
+    run: echo loop
+`,
+		"services/api/kip_config.yaml": `template: service
+version: v0.0.0
+scripts:
+  - name: check
+    needs: [":setup", build]
+    run: echo check
+  - name: build
+    command: make
+`,
+	}, &FakeRunner{})
+	defer cleanup()
+
+	nodes, err := ResolveScripts(p, "ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	needs := map[string][]string{}
+	order := []string{}
+	for _, node := range nodes {
+		needs[node.ID] = node.Needs
+		order = append(order, node.ID)
+	}
+
+	expectedOrder := []string{"install", "setup", "lint", "test", "api:build", "api:check", "ci"}
+	if !reflect.DeepEqual(order, expectedOrder) {
+		t.Errorf("expected the order %v, got %v", expectedOrder, order)
+	}
+
+	expectedNeeds := map[string][]string{
+		"install":   {},
+		"setup":     {},
+		"lint":      {"setup", "install"},
+		"test":      {"setup", "install"},
+		"api:build": {},
+		"api:check": {"setup", "api:build", "install"},
+		"ci":        {"install", "lint", "test", "api:check"},
+	}
+	if !reflect.DeepEqual(needs, expectedNeeds) {
+		t.Errorf("expected the needs %v, got %v", expectedNeeds, needs)
+	}
+
+	if !nodes[len(nodes)-1].Composite() {
+		t.Error("expected ci to be a composite script")
+	}
+
+	if _, err := ResolveScripts(p, "loop"); err == nil || err.Error() != "script cycle detected: loop -> loop" {
+		t.Errorf("expected a cycle error, got %v", err)
+	}
+
+	if _, err := ResolveScripts(testService(t, p, "api"), "missing"); !errors.Is(err, ErrScriptNotFound) {
+		t.Errorf("expected ErrScriptNotFound, got %v", err)
+	}
+}
+
+func TestScriptTimeoutAndRetries(t *testing.T) {
+	p, cleanup := newTestProject(t, map[string]string{
+		"kip_config.yaml": `template: project
+environment: dev
+version: v0.0.0
+scripts:
+  - name: flaky
+    retries: 2
+    retryDelay: 10ms
+    run: test -f .attempted || { touch .attempted; exit 1; }
+  - name: hanging
+    timeout: 200ms
+    run: sleep 5 & sleep 5
+  - name: failing
+    retries: 1
+    continueOnError: true
+    run: exit 3
+`,
+	}, &FakeRunner{})
+	defer cleanup()
+
+	get := func(name string) *Script {
+		script, err := p.GetScript(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return script
+	}
+
+	if err := get("flaky").Run(ioutil.Discard, []string{}); err != nil {
+		t.Errorf("expected the retry to succeed, got %v", err)
+	}
+
+	start := time.Now()
+	if err := get("hanging").Run(ioutil.Discard, []string{}); err == nil || err.Error() != "timed out after 200ms" {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+
+	// the background sleep keeps stdout open, the run only returns this early when the process group is killed
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the process group to be killed, the run took %s", elapsed)
+	}
+
+	failing := get("failing")
+	if !failing.ContinueOnError || failing.Retries != 1 {
+		t.Errorf("unexpected failure policy %+v", failing)
+	}
+
+	if err := failing.Run(ioutil.Discard, []string{}); err == nil {
+		t.Error("expected the failing script to return its error")
+	}
+}
+
+func TestTypeHelmValue(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected interface{}
+	}{
+		{value: "true", expected: true},
+		{value: "false", expected: false},
+		{value: "null", expected: nil},
+		{value: "3", expected: 3},
+		{value: "-3", expected: -3},
+		{value: "0", expected: 0},
+		{value: "on", expected: "on"},
+		{value: "yes", expected: "yes"},
+		{value: "0123", expected: "0123"},
+		{value: "-012", expected: "-012"},
+		{value: "1.5", expected: "1.5"},
+		{value: "1e3", expected: "1e3"},
+		{value: "example.com", expected: "example.com"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			if value := typeHelmValue(test.value); !reflect.DeepEqual(value, test.expected) {
+				t.Errorf("expected %#v, got %#v", test.expected, value)
+			}
+		})
+	}
+}
@@ -0,0 +1,855 @@
+package project
+
+import (
+	"debugged-dev/kip/v1/internal/version"
+	"debugged-dev/kip/v1/pkg/generator"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/spf13/viper"
+	"robpike.io/filter"
+)
+
+type ServiceProject struct {
+	path    string
+	config  *viper.Viper
+	project *MonoProject
+	env     *map[string]string
+	runner  Runner
+}
+
+func CreateServiceProject(path string, name string, generatorName string, args []string) error {
+	p := ServiceProject{path: filepath.Join(path, name)}
+	return p.New(name, generatorName, args)
+}
+
+func (s ServiceProject) Name() string {
+	return filepath.Base(s.path)
+}
+
+func (s ServiceProject) Template() string {
+	return s.config.GetString("template")
+}
+
+func (s ServiceProject) Environment() string {
+	return s.config.GetString("environment")
+}
+
+func (s ServiceProject) EnvConfig() map[string]*EnvConfig {
+	envConfigs := make(map[string]*EnvConfig)
+	s.config.UnmarshalKey("environments", &envConfigs)
+	return envConfigs
+}
+
+// Environments returns the names of all environments configured for the service or its project
+func (s ServiceProject) Environments() []string {
+	configs := s.EnvConfig()
+	if s.project != nil {
+		for name, config := range s.project.EnvConfig() {
+			configs[name] = config
+		}
+	}
+
+	environments := []string{}
+	for name := range configs {
+		environments = append(environments, name)
+	}
+
+	sort.Strings(environments)
+
+	return environments
+}
+
+func (s ServiceProject) Repository(environment string) (string, error) {
+	if s.config.IsSet("repository") {
+		return s.formatString(s.config.GetString("repository")), nil
+	}
+
+	configs := s.EnvConfig()
+	if val, ok := configs[environment]; ok && val.Repository != "" {
+		return s.formatString(val.Repository), nil
+	}
+
+	if s.project != nil && !s.config.IsSet("repository") {
+		value, err := s.project.Repository(environment)
+		return s.formatString(value), err
+	}
+
+	return "", fmt.Errorf("repository not set")
+}
+
+func (s ServiceProject) DockerBuildArgs(environment string) []string {
+	if s.config.IsSet("dockerBuildArgs") {
+		return s.formatStrings(s.config.GetStringSlice("dockerBuildArgs"))
+	}
+
+	configs := s.EnvConfig()
+	if val, ok := configs[environment]; ok && len(val.DockerBuildArgs) > 0 {
+		return s.formatStrings(val.DockerBuildArgs)
+	}
+
+	if s.project != nil && !s.config.IsSet("dockerBuildArgs") {
+		return s.formatStrings(s.project.DockerBuildArgs(environment))
+	}
+
+	return []string{}
+}
+
+func (s ServiceProject) WhitelistedContexts() []string {
+	if s.config.IsSet("whitelistedContexts") {
+		return s.config.GetStringSlice("whitelistedContexts")
+	}
+
+	if s.project != nil && !s.config.IsSet("whitelistedContexts") {
+		return s.project.WhitelistedContexts()
+	}
+
+	return []string{}
+}
+
+// Libraries returns the names of the project libraries the service depends on
+func (s ServiceProject) Libraries() []string {
+	return s.config.GetStringSlice("libraries")
+}
+
+// StateStore returns the store of the deploy state in the environment. Services of a project use the state
+// config of the project, the state is saved in the cluster and namespace the service deploys to
+func (s ServiceProject) StateStore(environment string) (StateStore, error) {
+	config := stateConfig{}
+	root := s.Paths().Root
+
+	if s.project != nil {
+		if err := s.project.config.UnmarshalKey("state", &config); err != nil {
+			return nil, err
+		}
+		root = s.project.Paths().Root
+	} else if err := s.config.UnmarshalKey("state", &config); err != nil {
+		return nil, err
+	}
+
+	if config.Namespace == "" {
+		config.Namespace = s.Namespace(environment)
+	}
+	return newStateStore(config, root, s.KubeContext(environment), s.commandRunner())
+}
+
+func (s ServiceProject) commandRunner() Runner {
+	if s.runner != nil {
+		return s.runner
+	}
+	if s.project != nil {
+		return s.project.commandRunner()
+	}
+	return ExecRunner{}
+}
+
+// Namespace returns the kubernetes namespace charts are deployed to in the environment
+func (s ServiceProject) Namespace(environment string) string {
+	configs := s.EnvConfig()
+	if val, ok := configs[environment]; ok && val.Namespace != "" {
+		return s.formatString(val.Namespace)
+	}
+
+	if s.config.IsSet("namespace") {
+		return s.formatString(s.config.GetString("namespace"))
+	}
+
+	if s.project != nil {
+		return s.project.Namespace(environment)
+	}
+
+	return ""
+}
+
+// KubeContext returns the kubeconfig context used for the environment, empty for the current context
+func (s ServiceProject) KubeContext(environment string) string {
+	configs := s.EnvConfig()
+	if val, ok := configs[environment]; ok && val.KubeContext != "" {
+		return s.formatString(val.KubeContext)
+	}
+
+	if s.config.IsSet("kubeContext") {
+		return s.formatString(s.config.GetString("kubeContext"))
+	}
+
+	if s.project != nil {
+		return s.project.KubeContext(environment)
+	}
+
+	return ""
+}
+
+// HelmArgs returns the extra arguments passed to helm in the environment
+func (s ServiceProject) HelmArgs(environment string) []string {
+	configs := s.EnvConfig()
+	if val, ok := configs[environment]; ok && len(val.HelmArgs) > 0 {
+		return s.formatStrings(val.HelmArgs)
+	}
+
+	if s.config.IsSet("helmArgs") {
+		return s.formatStrings(s.config.GetStringSlice("helmArgs"))
+	}
+
+	if s.project != nil {
+		return s.project.HelmArgs(environment)
+	}
+
+	return []string{}
+}
+
+// Platforms returns the platforms the image is built for in the environment, empty for the local platform
+func (s ServiceProject) Platforms(environment string) []string {
+	configs := s.EnvConfig()
+	if val, ok := configs[environment]; ok && len(val.Platforms) > 0 {
+		return val.Platforms
+	}
+
+	if s.config.IsSet("platforms") {
+		return s.config.GetStringSlice("platforms")
+	}
+
+	if s.project != nil {
+		return s.project.Platforms(environment)
+	}
+
+	return []string{}
+}
+
+func (s ServiceProject) Version() string {
+	return s.config.GetString("version")
+}
+
+func (s ServiceProject) BuildPath() string {
+	buildPath := s.Paths().BuildPathTemplate
+
+	if s.project != nil && !s.config.IsSet("buildPath") {
+		buildPath = s.project.Paths().BuildPathTemplate
+		buildPath = strings.ReplaceAll(buildPath, "<projectDir>", s.project.Paths().Root)
+	}
+
+	buildPath = strings.ReplaceAll(buildPath, "<projectDir>", s.Paths().Root)
+	buildPath = strings.ReplaceAll(buildPath, "<serviceDir>", s.Paths().Root)
+
+	return buildPath
+}
+
+// resolvePath fills in the <projectDir> and <serviceDir> placeholders, relative paths are relative to the service
+func (s ServiceProject) resolvePath(path string) string {
+	path = strings.ReplaceAll(path, "<projectDir>", s.rootPath())
+	path = strings.ReplaceAll(path, "<serviceDir>", s.Paths().Root)
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(s.Paths().Root, path)
+	}
+
+	return filepath.Clean(path)
+}
+
+// Dockerfile returns the path of the Dockerfile the service is built from in the environment
+func (s ServiceProject) Dockerfile(environment string) string {
+	configs := s.EnvConfig()
+	if val, ok := configs[environment]; ok && val.Dockerfile != "" {
+		return s.resolvePath(val.Dockerfile)
+	}
+
+	if s.config.IsSet("dockerfile") {
+		return s.resolvePath(s.config.GetString("dockerfile"))
+	}
+
+	if s.project != nil {
+		if dockerfile := s.project.dockerfile(environment); dockerfile != "" {
+			return s.resolvePath(dockerfile)
+		}
+	}
+
+	return filepath.Join(s.Paths().Root, "Dockerfile")
+}
+
+// Target returns the Dockerfile stage built in the environment, empty for the final stage
+func (s ServiceProject) Target(environment string) string {
+	configs := s.EnvConfig()
+	if val, ok := configs[environment]; ok && val.Target != "" {
+		return val.Target
+	}
+
+	if s.config.IsSet("target") {
+		return s.config.GetString("target")
+	}
+
+	if s.project != nil {
+		return s.project.Target(environment)
+	}
+
+	return ""
+}
+
+// BuildContext returns the directory sent as build context in the environment, the build path by default
+func (s ServiceProject) BuildContext(environment string) string {
+	configs := s.EnvConfig()
+	if val, ok := configs[environment]; ok && val.Context != "" {
+		return s.resolvePath(val.Context)
+	}
+
+	if s.config.IsSet("context") {
+		return s.resolvePath(s.config.GetString("context"))
+	}
+
+	if s.project != nil {
+		if context := s.project.buildContext(environment); context != "" {
+			return s.resolvePath(context)
+		}
+	}
+
+	return s.BuildPath()
+}
+
+func (s ServiceProject) Paths() paths {
+	buildPathTemplate := "<projectDir>"
+
+	if s.config != nil && s.config.IsSet("buildPath") && len(s.config.GetString("buildPath")) > 0 {
+		buildPathTemplate = s.config.GetString("buildPath")
+	}
+
+	return paths{
+		Root:              s.path,
+		Deployments:       filepath.Join(s.path, "deployments"),
+		Environments:      filepath.Join(s.path, "environments"),
+		Scripts:           filepath.Join(s.path, "scripts"),
+		BuildPathTemplate: buildPathTemplate,
+	}
+}
+
+func (s ServiceProject) New(name string, generatorName string, args []string) error {
+
+	paths := s.Paths()
+
+	if _, err := os.Stat(paths.Root); !os.IsNotExist(err) {
+		return fmt.Errorf("folder %s already exist", name)
+	}
+
+	err := generator.Generate(generatorName, filepath.Join(paths.Root, ".."), name, args)
+
+	if err != nil {
+		return err
+	}
+
+	os.MkdirAll(paths.Services, os.ModePerm)
+	os.MkdirAll(paths.Environments, os.ModePerm)
+	os.MkdirAll(paths.Deployments, os.ModePerm)
+
+	config := viper.New()
+	config.AddConfigPath(paths.Root)
+	config.SetConfigName("kip_config")
+	config.SetConfigType("yaml")
+
+	config.Set("template", "service")
+	config.Set("version", version.Get().Version)
+	config.Set("environment", "dev")
+
+	config.SafeWriteConfig()
+
+	return nil
+}
+
+func (s ServiceProject) formatString(value string) string {
+	r := regexp.MustCompile(`\${[a-zA-Z_0-9]+}`)
+	matches := r.FindAllString(value, -1)
+	for _, match := range matches {
+		envName := match[2 : len(match)-1]
+		value = strings.ReplaceAll(value, match, s.getEnv(envName))
+	}
+	return value
+}
+
+func (s ServiceProject) formatStrings(values []string) []string {
+	for i, value := range values {
+		values[i] = s.formatString(value)
+	}
+	return values
+}
+
+func (s ServiceProject) Services() ([]ServiceProject, error) {
+	return []ServiceProject{s}, nil
+}
+
+func (p ServiceProject) GetService(name string) (*ServiceProject, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s ServiceProject) Charts() ([]Chart, error) {
+	return getCharts(s.Paths().Deployments, s)
+}
+
+func (s ServiceProject) AddChart(chartName string, args []string) (string, error) {
+	return createChart(s.commandRunner(), chartName, s.Paths().Deployments, args)
+}
+
+func (s ServiceProject) GetScript(name string) (*Script, error) {
+	scripts, err := s.GetScripts("", "")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, script := range scripts {
+		if script.Name == name {
+			return &script, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrScriptNotFound, name)
+}
+
+func (s ServiceProject) GetScripts(binding string, environment string) ([]Script, error) {
+	var scripts []Script
+	err := s.config.UnmarshalKey("scripts", &scripts)
+
+	if err != nil {
+		return nil, &ConfigError{Path: s.config.ConfigFileUsed(), Err: err}
+	}
+
+	scripts = filter.Apply(scripts, func(script Script) Script {
+		script.Path = s.Paths().Root
+		script.LegacyOutput = script.LegacyOutput || s.LegacyScriptOutput()
+		script.format = s.formatString
+		return script
+	}).([]Script)
+
+	if binding != "" {
+		scripts = filter.Choose(scripts, func(s Script) bool {
+			for _, value := range s.Bindings {
+				if value == binding {
+					return true
+				}
+			}
+			return false
+		}).([]Script)
+	}
+
+	if environment != "" {
+		scripts = filter.Choose(scripts, func(s Script) bool {
+
+			if len(s.Environments) == 0 {
+				return true
+			}
+
+			for _, value := range s.Environments {
+				if value == environment {
+					return true
+				}
+			}
+			return false
+		}).([]Script)
+	}
+
+	return scripts, nil
+}
+
+// LegacyScriptOutput returns whether scripts still set the KEY=VALUE lines they print as environment variables
+func (s ServiceProject) LegacyScriptOutput() bool {
+	if s.config.IsSet("legacyScriptOutput") {
+		return s.config.GetBool("legacyScriptOutput")
+	}
+
+	if s.project != nil {
+		return s.project.LegacyScriptOutput()
+	}
+
+	return false
+}
+
+// AddScript adds a script that runs command to the config
+func (s ServiceProject) AddScript(name string, command string, bindings []string) error {
+	return s.AddScriptConfig(Script{Name: name, Command: command, Bindings: bindings})
+}
+
+// AddScriptConfig adds a script with all its settings, like run or needs, to the config
+func (s ServiceProject) AddScriptConfig(script Script) error {
+	configs := []scriptConfig{}
+	if err := s.config.UnmarshalKey("scripts", &configs); err != nil {
+		return &ConfigError{Path: s.config.ConfigFileUsed(), Err: err}
+	}
+
+	scriptConfigs, err := addScript(configs, script)
+	if err != nil {
+		return err
+	}
+
+	s.config.Set("scripts", scriptConfigs)
+
+	return s.config.WriteConfig()
+}
+
+// HasDockerfile reports if the Dockerfile of the environment exists
+func (s ServiceProject) HasDockerfile(environment string) bool {
+	_, err := os.Stat(s.Dockerfile(environment))
+	return !os.IsNotExist(err)
+}
+
+// Build builds the service image and tags it with the key and its image ID. The build is
+// skipped when an image for the same build context hash already exists, unless force is set
+func (s ServiceProject) Build(repository string, key string, args []string, environment string, force bool) ([]byte, bool, error) {
+	return s.BuildOutput(nil, repository, key, args, environment, force)
+}
+
+// BuildOutput builds like Build and writes the output of the builder to out while the build runs
+func (s ServiceProject) BuildOutput(out io.Writer, repository string, key string, args []string, environment string, force bool) ([]byte, bool, error) {
+	buildContext := s.BuildContext(environment)
+
+	servicePath, err := filepath.Rel(buildContext, s.Dockerfile(environment))
+
+	if repository == "" {
+		repository, err = s.Repository(environment)
+	}
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	if target := s.Target(environment); target != "" {
+		// an explicit --target in args comes last and wins
+		args = append([]string{"--target", target}, args...)
+	}
+
+	platforms := s.Platforms(environment)
+
+	hashArgs := args
+	if len(platforms) > 0 {
+		hashArgs = append(append([]string{}, args...), "--platform", strings.Join(platforms, ","))
+	}
+
+	contextHash, err := s.ContextHash(hashArgs, environment)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	tempId := "temp-" + key
+	hashTag := "kip-" + contextHash
+	skipped := false
+
+	var output []byte
+
+	tags := []string{repository + s.Name() + ":" + tempId, repository + s.Name() + ":" + hashTag}
+	upToDate := false
+
+	if hashID, err := s.GetFullImageID(hashTag, repository, environment); err == nil && !force {
+		upToDate = true
+
+		if s.pushesWhileBuilding(environment) {
+			// the key is a tag in the registry, the build is only skipped when it points to the same image
+			keyID, err := s.GetFullImageID(key, repository, environment)
+			upToDate = err == nil && keyID == hashID
+		}
+	}
+
+	if s.pushesWhileBuilding(environment) {
+		tags = append(tags, repository+s.Name()+":"+key)
+	}
+
+	if upToDate {
+		skipped = true
+		output = []byte(fmt.Sprintf("image %s%s:%s is up to date\n", repository, s.Name(), hashTag))
+
+		err = s.TagImage(hashTag, tempId, repository, environment)
+
+		if err != nil {
+			return output, skipped, err
+		}
+	} else {
+		builder, err := s.builder(environment)
+		if err != nil {
+			return nil, skipped, err
+		}
+
+		output, err = builder.Build(ImageBuild{
+			Context:    buildContext,
+			Dockerfile: servicePath,
+			Tags:       tags,
+			Platforms:  platforms,
+			Cache:      s.Cache(repository, environment),
+			Args:       args,
+			Output:     out,
+		})
+		if err != nil {
+			return output, skipped, err
+		}
+	}
+
+	if !s.pushesWhileBuilding(environment) {
+		tempID, err := s.GetImageID(tempId, repository, environment)
+
+		if err != nil {
+			return output, skipped, err
+		}
+
+		err = s.TagImage(tempId, tempID, repository, environment)
+
+		if err != nil {
+			return output, skipped, err
+		}
+	}
+
+	err = s.TagImage(tempId, key, repository, environment)
+
+	if err != nil {
+		return output, skipped, err
+	}
+
+	return output, skipped, err
+}
+
+func (s ServiceProject) Push(repository string, key string, args []string, environment string) ([]byte, error) {
+
+	var err error
+
+	if repository == "" {
+		repository, err = s.Repository(environment)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	imageID, err := s.GetImageID(key, repository, environment)
+
+	if err != nil {
+		return nil, err
+	}
+
+	builder, err := s.builder(environment)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// images pushed while building are tagged with the key instead of the image ID
+	tag := imageID
+	if s.pushesWhileBuilding(environment) {
+		tag = key
+	}
+
+	output, err := builder.Push(repository+s.Name()+":"+tag, args)
+
+	if err != nil {
+		return output, err
+	}
+
+	fullImageID, err := s.GetFullImageID(key, repository, environment)
+
+	if err != nil {
+		return output, err
+	}
+
+	digest, err := s.GetRepoDigest(tag, repository, environment)
+
+	if err != nil {
+		return output, err
+	}
+
+	image := ServiceImage{Repository: repository, Name: s.Name(), Tag: tag, ImageID: fullImageID, Digest: digest, Key: key}
+	err = saveImageRecord(s.rootPath(), environment, image)
+
+	return output, err
+}
+
+// GetRepoDigest returns the registry manifest digest of a pushed image
+func (s ServiceProject) GetRepoDigest(tag string, repository string, environment string) (string, error) {
+	builder, err := s.builder(environment)
+
+	if err != nil {
+		return "", err
+	}
+
+	repoDigests, err := builder.RepoDigests(repository + s.Name() + ":" + tag)
+
+	if err != nil {
+		return "", err
+	}
+
+	name := normalizeRepository(repository + s.Name())
+
+	// docker reports docker.io images without the registry, compare the normalized names
+	for _, repoDigest := range repoDigests {
+		parts := strings.SplitN(repoDigest, "@", 2)
+		if len(parts) == 2 && normalizeRepository(parts[0]) == name {
+			return parts[1], nil
+		}
+	}
+
+	return "", fmt.Errorf("no registry digest found for %s%s:%s", repository, s.Name(), tag)
+}
+
+// normalizeRepository returns the name docker hub repositories are reported with, docker.io/nginx is library/nginx
+func normalizeRepository(repository string) string {
+	for _, registry := range []string{"docker.io/", "index.docker.io/", "registry-1.docker.io/"} {
+		repository = strings.TrimPrefix(repository, registry)
+	}
+
+	if !strings.Contains(repository, "/") {
+		return "library/" + repository
+	}
+
+	return repository
+}
+
+// rootPath returns the root of the project the service belongs to
+func (s ServiceProject) rootPath() string {
+	if s.project != nil {
+		return s.project.Paths().Root
+	}
+	return s.Paths().Root
+}
+
+func (s ServiceProject) GetImageID(tag string, repository string, environment string) (string, error) {
+	imageID, err := s.GetFullImageID(tag, repository, environment)
+
+	if err != nil {
+		return "", err
+	}
+
+	return imageID[7:19], nil
+}
+
+// GetFullImageID returns the complete sha256 image ID of the tagged image
+func (s ServiceProject) GetFullImageID(tag string, repository string, environment string) (string, error) {
+	builder, err := s.builder(environment)
+
+	if err != nil {
+		return "", err
+	}
+
+	imageID, err := builder.ImageID(repository + s.Name() + ":" + tag)
+
+	if err != nil {
+		return "", err
+	}
+
+	if !strings.HasPrefix(imageID, "sha256:") || len(imageID) < 19 {
+		return "", fmt.Errorf("unexpected image ID \"%s\"", imageID)
+	}
+
+	return imageID, nil
+}
+
+// Image returns the image that was built for the key in the environment
+func (s ServiceProject) Image(repository string, key string, environment string) (ServiceImage, error) {
+	var err error
+
+	if repository == "" {
+		repository, err = s.Repository(environment)
+	}
+
+	if err != nil {
+		return ServiceImage{}, err
+	}
+
+	if reference, ok := scriptImage(s.Name()); ok {
+		return scriptServiceImage(s.Name(), key, reference), nil
+	}
+
+	tag := "latest"
+
+	if key != "" {
+		tag = "temp-" + key
+	}
+
+	imageID, err := s.GetFullImageID(tag, repository, environment)
+	record, found := loadImageRecord(s.rootPath(), environment, s.Name(), key)
+
+	if err != nil {
+		// the image may have been built and pushed by another job
+		if found && record.Repository == repository {
+			return record, nil
+		}
+		return ServiceImage{}, err
+	}
+
+	image := ServiceImage{Repository: repository, Name: s.Name(), Tag: imageID[7:19], ImageID: imageID, Key: key}
+
+	// the image ID of images pushed while building is their digest in the registry
+	if s.pushesWhileBuilding(environment) {
+		image.Tag = strings.TrimPrefix(tag, "temp-")
+		image.Digest = imageID
+	}
+
+	// only use the digest when the pushed image is the one that was built
+	if found && record.Repository == repository && record.ImageID == imageID {
+		image.Digest = record.Digest
+	}
+
+	return image, nil
+}
+
+// ImageValuesPath returns the values path the service images are written to
+func (s ServiceProject) ImageValuesPath() string {
+	if s.config.IsSet("imageValuesPath") {
+		return s.config.GetString("imageValuesPath")
+	}
+
+	if s.project != nil {
+		return s.project.ImageValuesPath()
+	}
+
+	return DefaultImageValuesPath
+}
+
+func (s ServiceProject) TagImage(currentTag string, newTag string, repository string, environment string) error {
+
+	builder, err := s.builder(environment)
+
+	if err != nil {
+		return err
+	}
+
+	return builder.Tag(repository+s.Name()+":"+currentTag, repository+s.Name()+":"+newTag)
+}
+
+func (s ServiceProject) getEnv(key string) string {
+	value := (*s.env)[key]
+	if value == "" {
+		value = os.Getenv(key)
+	}
+	return value
+}
+
+func getServices(path string, project *MonoProject) ([]ServiceProject, error) {
+	services := []ServiceProject{}
+
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		if f.IsDir() {
+			serviceName := f.Name()
+			servicePath := filepath.Join(path, serviceName)
+
+			serviceConfig := viper.New()
+			serviceConfig.AddConfigPath(servicePath)
+			serviceConfig.SetConfigName("kip_config")
+			serviceConfig.SetConfigType("yaml")
+
+			err := serviceConfig.ReadInConfig()
+
+			if err != nil {
+				return nil, &ConfigError{Path: filepath.Join(servicePath, "kip_config.yaml"), Err: err}
+			}
+
+			env, _ := godotenv.Read(filepath.Join(servicePath, ".env"))
+
+			s := ServiceProject{path: servicePath, project: project, config: serviceConfig, env: &env, runner: project.runner}
+			services = append(services, s)
+		}
+	}
+
+	return services, nil
+}
@@ -0,0 +1,385 @@
+package project
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var monoProjectFiles = map[string]string{
+	"kip_config.yaml": `template: project
+environment: dev
+version: v0.0.0
+environments:
+  dev:
+    repository: registry.local/
+`,
+	"services/api/kip_config.yaml": "template: service\nversion: v0.0.0\n",
+	"services/api/Dockerfile":      "FROM scratch\n",
+}
+
+var serviceProjectFiles = map[string]string{
+	"kip_config.yaml": `template: service
+environment: dev
+version: v0.0.0
+repository: registry.local/
+`,
+	"Dockerfile": "FROM scratch\n",
+}
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		service string
+		image   string
+	}{
+		{name: "project", files: monoProjectFiles, service: "api", image: "registry.local/api"},
+		{name: "service", files: serviceProjectFiles, service: "shop", image: "registry.local/shop"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			runner := &FakeRunner{}
+			p, cleanup := newTestProject(t, test.files, runner)
+			defer cleanup()
+
+			service := testService(t, p, test.service)
+			args := []string{"--build-arg", "VERSION=1"}
+
+			hash, err := service.ContextHash(args, "dev")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			runner.On("docker inspect --format {{.Id}} "+test.image+":temp-latest", testImageID+"\n", nil)
+			runner.On("docker inspect --format {{.Id}} "+test.image+":kip-", "", errors.New("no such image"))
+
+			_, skipped, err := service.Build("", "latest", args, "dev", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if skipped {
+				t.Error("expected the build not to be skipped")
+			}
+
+			assertCalls(t, runner, [][]string{
+				{"docker", "inspect", "--format", "{{.Id}}", test.image + ":kip-" + hash},
+				{"docker", "build", service.Paths().Root, "-f", "Dockerfile", "-t", test.image + ":temp-latest", "-t", test.image + ":kip-" + hash, "--build-arg", "VERSION=1"},
+				{"docker", "inspect", "--format", "{{.Id}}", test.image + ":temp-latest"},
+				{"docker", "tag", test.image + ":temp-latest", test.image + ":0123456789ab"},
+				{"docker", "tag", test.image + ":temp-latest", test.image + ":latest"},
+			})
+
+			if dir := runner.Calls()[1].Dir; dir != service.Paths().Root {
+				t.Errorf("expected docker build to run in %s, got %s", service.Paths().Root, dir)
+			}
+		})
+	}
+}
+
+func TestBuildSkipsUnchangedContext(t *testing.T) {
+	runner := &FakeRunner{}
+	p, cleanup := newTestProject(t, monoProjectFiles, runner)
+	defer cleanup()
+
+	service := testService(t, p, "api")
+
+	hash, err := service.ContextHash([]string{}, "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner.On("docker inspect", testImageID+"\n", nil)
+
+	_, skipped, err := service.Build("", "latest", []string{}, "dev", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !skipped {
+		t.Error("expected the build to be skipped")
+	}
+
+	assertCalls(t, runner, [][]string{
+		{"docker", "inspect", "--format", "{{.Id}}", "registry.local/api:kip-" + hash},
+		{"docker", "tag", "registry.local/api:kip-" + hash, "registry.local/api:temp-latest"},
+		{"docker", "inspect", "--format", "{{.Id}}", "registry.local/api:temp-latest"},
+		{"docker", "tag", "registry.local/api:temp-latest", "registry.local/api:0123456789ab"},
+		{"docker", "tag", "registry.local/api:temp-latest", "registry.local/api:latest"},
+	})
+
+	runner.Reset()
+
+	if _, _, err := service.Build("", "latest", []string{}, "dev", true); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls := runner.Calls(); len(calls) < 2 || calls[1].Args[0] != "build" {
+		t.Errorf("expected --force to build, got %v", calls)
+	}
+}
+
+func TestBuildFailure(t *testing.T) {
+	runner := &FakeRunner{}
+	p, cleanup := newTestProject(t, monoProjectFiles, runner)
+	defer cleanup()
+
+	runner.On("docker inspect", "", errors.New("no such image"))
+	runner.On("docker build", "", errors.New("exit status 1"))
+
+	_, _, err := testService(t, p, "api").Build("", "latest", []string{}, "dev", false)
+	if err == nil {
+		t.Fatal("expected the build to fail")
+	}
+
+	if calls := runner.Calls(); len(calls) != 2 {
+		t.Errorf("expected no commands after the failed build, got %v", calls)
+	}
+}
+
+func TestPush(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		service string
+		image   string
+	}{
+		{name: "project", files: monoProjectFiles, service: "api", image: "registry.local/api"},
+		{name: "service", files: serviceProjectFiles, service: "shop", image: "registry.local/shop"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			runner := &FakeRunner{}
+			p, cleanup := newTestProject(t, test.files, runner)
+			defer cleanup()
+
+			service := testService(t, p, test.service)
+
+			runner.On("docker inspect --format {{.Id}}", testImageID+"\n", nil)
+			runner.On("docker inspect --format {{join .RepoDigests", test.image+"@sha256:feed\n", nil)
+
+			if _, err := service.Push("", "latest", []string{}, "dev"); err != nil {
+				t.Fatal(err)
+			}
+
+			assertCalls(t, runner, [][]string{
+				{"docker", "inspect", "--format", "{{.Id}}", test.image + ":latest"},
+				{"docker", "push", test.image + ":0123456789ab"},
+				{"docker", "inspect", "--format", "{{.Id}}", test.image + ":latest"},
+				{"docker", "inspect", "--format", "{{join .RepoDigests \"\\n\"}}", test.image + ":0123456789ab"},
+			})
+
+			record, found := loadImageRecord(p.Paths().Root, "dev", service.Name(), "latest")
+			if !found {
+				t.Fatalf("expected an image record in %s", filepath.Join(p.Paths().Root, ".kip"))
+			}
+
+			if record.Digest != "sha256:feed" || record.ImageID != testImageID {
+				t.Errorf("unexpected image record %+v", record)
+			}
+		})
+	}
+}
+
+func TestGetRepoDigest(t *testing.T) {
+	tests := []struct {
+		name        string
+		repository  string
+		repoDigests string
+		expected    string
+	}{
+		{name: "private registry", repository: "registry.local/", repoDigests: "registry.local/api@sha256:feed", expected: "sha256:feed"},
+		{name: "docker hub organization", repository: "docker.io/shop/", repoDigests: "shop/api@sha256:feed", expected: "sha256:feed"},
+		{name: "docker hub index", repository: "index.docker.io/shop/", repoDigests: "shop/api@sha256:feed", expected: "sha256:feed"},
+		{name: "docker hub library", repository: "docker.io/", repoDigests: "api@sha256:feed", expected: "sha256:feed"},
+		{name: "docker hub library with prefix", repository: "docker.io/library/", repoDigests: "api@sha256:feed", expected: "sha256:feed"},
+		{name: "other repositories are skipped", repository: "registry.local/", repoDigests: "mirror.local/api@sha256:0000\nregistry.local/api@sha256:feed", expected: "sha256:feed"},
+		{name: "no digest of the repository", repository: "registry.local/", repoDigests: "registry.local/web@sha256:feed", expected: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			runner := &FakeRunner{}
+			p, cleanup := newTestProject(t, monoProjectFiles, runner)
+			defer cleanup()
+
+			runner.On("docker inspect --format {{join .RepoDigests", test.repoDigests+"\n", nil)
+
+			digest, err := testService(t, p, "api").GetRepoDigest("0123456789ab", test.repository, "dev")
+			if test.expected == "" {
+				if err == nil {
+					t.Errorf("expected no digest, got %s", digest)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if digest != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, digest)
+			}
+		})
+	}
+}
+
+func TestBuildDockerfileTargetAndContext(t *testing.T) {
+	runner := &FakeRunner{}
+	p, cleanup := newTestProject(t, map[string]string{
+		"kip_config.yaml": `template: project
+environment: dev
+version: v0.0.0
+environments:
+  dev:
+    repository: registry.local/
+  prod:
+    repository: registry.local/
+`,
+		"services/api/kip_config.yaml": `template: service
+version: v0.0.0
+dockerfile: docker/Dockerfile
+context: <projectDir>
+environments:
+  dev:
+    target: dev
+`,
+		"services/api/docker/Dockerfile": "FROM scratch as dev\nFROM scratch\n",
+	}, runner)
+	defer cleanup()
+
+	service := testService(t, p, "api")
+	root := p.Paths().Root
+
+	if !service.HasDockerfile("dev") {
+		t.Error("expected the configured Dockerfile to be found")
+	}
+
+	tests := []struct {
+		environment string
+		target      []string
+	}{
+		{environment: "dev", target: []string{"--target", "dev"}},
+		{environment: "prod", target: []string{}},
+	}
+
+	for _, test := range tests {
+		runner.Reset()
+		runner.On("docker inspect", testImageID+"\n", nil)
+		runner.On("docker inspect --format {{.Id}} registry.local/api:kip-", "", errors.New("no such image"))
+
+		hash, err := service.ContextHash(test.target, test.environment)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, _, err := service.Build("", "latest", []string{}, test.environment, false); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := append([]string{"build", root, "-f", filepath.Join("services", "api", "docker", "Dockerfile"), "-t", "registry.local/api:temp-latest", "-t", "registry.local/api:kip-" + hash}, test.target...)
+		if call := runner.Calls()[1]; !reflect.DeepEqual(call.Args, expected) || call.Dir != root {
+			t.Errorf("expected docker %v in %s for %s, got %v in %s", expected, root, test.environment, call.Args, call.Dir)
+		}
+	}
+}
+
+func TestEnvironmentFallsBackPerSetting(t *testing.T) {
+	p, cleanup := newTestProject(t, map[string]string{
+		"kip_config.yaml": `template: project
+environment: dev
+version: v0.0.0
+repository: registry.local/
+dockerBuildArgs: [--build-arg, VERSION=1]
+environments:
+  staging:
+    namespace: staging
+  prod:
+    repository: registry.prod/
+    dockerBuildArgs: [--build-arg, VERSION=2]
+`,
+		"services/api/kip_config.yaml": "template: service\nversion: v0.0.0\n",
+	}, &FakeRunner{})
+	defer cleanup()
+
+	tests := []struct {
+		environment string
+		repository  string
+		buildArgs   []string
+		namespace   string
+	}{
+		{environment: "dev", repository: "registry.local/", buildArgs: []string{"--build-arg", "VERSION=1"}},
+		{environment: "staging", repository: "registry.local/", buildArgs: []string{"--build-arg", "VERSION=1"}, namespace: "staging"},
+		{environment: "prod", repository: "registry.prod/", buildArgs: []string{"--build-arg", "VERSION=2"}},
+	}
+
+	for _, test := range tests {
+		for _, owner := range []Project{p, testService(t, p, "api")} {
+			repository, err := owner.Repository(test.environment)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if repository != test.repository {
+				t.Errorf("expected the repository %s of %s in %s, got %s", test.repository, owner.Name(), test.environment, repository)
+			}
+
+			if buildArgs := owner.DockerBuildArgs(test.environment); !reflect.DeepEqual(buildArgs, test.buildArgs) {
+				t.Errorf("expected the build args %v of %s in %s, got %v", test.buildArgs, owner.Name(), test.environment, buildArgs)
+			}
+
+			if namespace := owner.Namespace(test.environment); namespace != test.namespace {
+				t.Errorf("expected the namespace %s of %s in %s, got %s", test.namespace, owner.Name(), test.environment, namespace)
+			}
+		}
+	}
+}
+
+func TestDockerfileAndContextFallBackToTheProject(t *testing.T) {
+	p, cleanup := newTestProject(t, map[string]string{
+		"kip_config.yaml": `template: project
+environment: dev
+version: v0.0.0
+dockerfile: docker/Dockerfile
+environments:
+  prod:
+    dockerfile: Dockerfile.prod
+    context: <projectDir>
+`,
+		"services/api/kip_config.yaml": "template: service\nversion: v0.0.0\n",
+		"services/web/kip_config.yaml": "template: service\nversion: v0.0.0\ndockerfile: Dockerfile\nenvironments:\n  prod:\n    context: .\n",
+	}, &FakeRunner{})
+	defer cleanup()
+
+	root := p.Paths().Root
+	api := filepath.Join(root, "services", "api")
+	web := filepath.Join(root, "services", "web")
+
+	tests := []struct {
+		service     string
+		environment string
+		dockerfile  string
+		context     string
+	}{
+		{service: "api", environment: "dev", dockerfile: filepath.Join(api, "docker", "Dockerfile"), context: testService(t, p, "api").BuildPath()},
+		{service: "api", environment: "prod", dockerfile: filepath.Join(api, "Dockerfile.prod"), context: root},
+		{service: "web", environment: "dev", dockerfile: filepath.Join(web, "Dockerfile"), context: testService(t, p, "web").BuildPath()},
+		{service: "web", environment: "prod", dockerfile: filepath.Join(web, "Dockerfile"), context: web},
+	}
+
+	for _, test := range tests {
+		service := testService(t, p, test.service)
+
+		if dockerfile := service.Dockerfile(test.environment); dockerfile != test.dockerfile {
+			t.Errorf("expected the Dockerfile %s of %s in %s, got %s", test.dockerfile, test.service, test.environment, dockerfile)
+		}
+
+		if context := service.BuildContext(test.environment); context != test.context {
+			t.Errorf("expected the context %s of %s in %s, got %s", test.context, test.service, test.environment, context)
+		}
+	}
+}
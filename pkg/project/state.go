@@ -0,0 +1,337 @@
+package project
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// StateKey identifies the deploy state of a chart in an environment
+type StateKey struct {
+	Project     string
+	Service     string
+	Chart       string
+	Environment string
+}
+
+// Name returns the kubernetes compatible resource name for the key
+func (k StateKey) Name() string {
+	parts := []string{"kip"}
+
+	for _, part := range []string{k.Project, k.Service, k.Chart, k.Environment} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	name := strings.ToLower(strings.Join(parts, "."))
+	name = regexp.MustCompile(`[^a-z0-9.-]`).ReplaceAllString(name, "-")
+
+	if len(name) > 253 {
+		name = name[:253]
+	}
+
+	return name
+}
+
+// DeployState is the state kip saves after deploying a chart
+type DeployState struct {
+	Hash     string `json:"hash"`
+	Manifest string `json:"manifest,omitempty"`
+}
+
+// StateStore saves and loads the deploy state of charts
+type StateStore interface {
+	Get(key StateKey) (DeployState, error)
+	Save(key StateKey, state DeployState) error
+}
+
+type stateConfig struct {
+	Backend   string `mapstructure:"backend"`
+	Namespace string `mapstructure:"namespace"`
+	Path      string `mapstructure:"path"`
+}
+
+func newStateStore(config stateConfig, root string, kubeContext string, runner Runner) (StateStore, error) {
+	switch config.Backend {
+	case "", "secret":
+		return kubernetesStateStore{kind: "secret", namespace: config.Namespace, context: kubeContext, runner: runner}, nil
+	case "configmap":
+		return kubernetesStateStore{kind: "configmap", namespace: config.Namespace, context: kubeContext, runner: runner}, nil
+	case "file":
+		path := config.Path
+		if path == "" {
+			path = filepath.Join(".kip", "state.json")
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(root, path)
+		}
+		return sharedFileStateStore(path), nil
+	default:
+		return nil, fmt.Errorf("state backend \"%s\" not supported, use secret, configmap or file", config.Backend)
+	}
+}
+
+// kubernetesStateStore saves the state in a secret or configmap
+type kubernetesStateStore struct {
+	kind      string
+	namespace string
+	context   string
+	runner    Runner
+}
+
+func (k kubernetesStateStore) kubectlArgs(args ...string) []string {
+	if k.context != "" {
+		args = append(args, "--context", k.context)
+	}
+	if k.namespace != "" {
+		args = append(args, "--namespace", k.namespace)
+	}
+	return args
+}
+
+func (k kubernetesStateStore) Get(key StateKey) (DeployState, error) {
+	state := DeployState{}
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd := Command{Name: "kubectl", Args: k.kubectlArgs("get", k.kind, key.Name(), "--ignore-not-found", "-o", "json"), Stdout: &stdout, Stderr: &stderr}
+
+	if err := k.runner.Run(cmd); err != nil {
+		return state, fmt.Errorf("unable to read %s %s: %s", k.kind, key.Name(), strings.TrimSpace(stderr.String()))
+	}
+
+	if stdout.Len() == 0 {
+		return state, nil
+	}
+
+	var resource struct {
+		Data map[string]string `json:"data"`
+	}
+
+	if err := json.Unmarshal(stdout.Bytes(), &resource); err != nil {
+		return state, err
+	}
+
+	data := resource.Data
+
+	if k.kind == "secret" {
+		for field, value := range data {
+			decoded, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return state, err
+			}
+			data[field] = string(decoded)
+		}
+	}
+
+	state.Hash = data["hash"]
+	state.Manifest = data["manifest"]
+
+	if encoded, ok := data[compressedManifestKey]; ok {
+		manifest, err := decompressManifest(encoded)
+		if err != nil {
+			return state, fmt.Errorf("unable to read %s %s: %v", k.kind, key.Name(), err)
+		}
+		state.Manifest = manifest
+	}
+
+	return state, nil
+}
+
+func (k kubernetesStateStore) Save(key StateKey, state DeployState) error {
+	manifest, err := compressManifest(redactSecrets(state.Manifest))
+	if err != nil {
+		return err
+	}
+
+	data := map[string]string{"hash": state.Hash, compressedManifestKey: manifest}
+
+	resource := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name": key.Name(),
+			"labels": map[string]string{
+				"app.kubernetes.io/managed-by": "kip",
+			},
+			"annotations": map[string]string{
+				"kip/project":     key.Project,
+				"kip/service":     key.Service,
+				"kip/chart":       key.Chart,
+				"kip/environment": key.Environment,
+			},
+		},
+		"data": data,
+	}
+
+	if k.kind == "secret" {
+		resource["kind"] = "Secret"
+		resource["type"] = "Opaque"
+		delete(resource, "data")
+		resource["stringData"] = data
+	}
+
+	content, err := json.Marshal(resource)
+	if err != nil {
+		return err
+	}
+
+	// server side apply creates or updates the resource in a single request without copying it into the
+	// last-applied annotation, which is limited to 256KiB
+	args := k.kubectlArgs("apply", "--server-side", "--force-conflicts", "--field-manager", "kip", "-f", "-")
+	output, err := combinedOutput(k.runner, Command{Name: "kubectl", Args: args, Stdin: bytes.NewReader(content)})
+
+	if err != nil {
+		return fmt.Errorf("unable to save %s %s: %s", k.kind, key.Name(), strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// compressedManifestKey is the data field of the gzipped and base64 encoded manifest, states saved by older
+// versions of kip have the plain manifest in the manifest field
+const compressedManifestKey = "manifest.gz"
+
+func compressManifest(manifest string) (string, error) {
+	var buf bytes.Buffer
+
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(manifest)); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+func decompressManifest(encoded string) (string, error) {
+	compressed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+
+	manifest, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return "", err
+	}
+
+	return string(manifest), nil
+}
+
+// fileStateStore saves the state of all charts in a local json file
+type fileStateStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+var (
+	fileStateStoresMutex sync.Mutex
+	fileStateStores      = map[string]*fileStateStore{}
+)
+
+// sharedFileStateStore returns the store of the path, charts deployed in parallel share it so their
+// read-modify-write saves do not overwrite each other
+func sharedFileStateStore(path string) *fileStateStore {
+	fileStateStoresMutex.Lock()
+	defer fileStateStoresMutex.Unlock()
+
+	path = filepath.Clean(path)
+	if store, ok := fileStateStores[path]; ok {
+		return store
+	}
+
+	store := &fileStateStore{path: path}
+	fileStateStores[path] = store
+	return store
+}
+
+func (f *fileStateStore) read() (map[string]DeployState, error) {
+	states := map[string]DeployState{}
+
+	content, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return states, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, &states); err != nil {
+		return nil, fmt.Errorf("unable to read state file %s: %v", f.path, err)
+	}
+
+	return states, nil
+}
+
+func (f *fileStateStore) Get(key StateKey) (DeployState, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	states, err := f.read()
+	if err != nil {
+		return DeployState{}, err
+	}
+
+	return states[key.Name()], nil
+}
+
+func (f *fileStateStore) Save(key StateKey, state DeployState) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	states, err := f.read()
+	if err != nil {
+		return err
+	}
+
+	state.Manifest = redactSecrets(state.Manifest)
+	states[key.Name()] = state
+
+	content, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(f.path), os.ModePerm); err != nil {
+		return err
+	}
+
+	// write to a temp file first so an interrupted save never leaves a broken state file
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), filepath.Base(f.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), f.path)
+}
@@ -0,0 +1,182 @@
+package project
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFileStateStoreConcurrentSaves(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kip-state-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			// every deploy asks the project for its store, like deploys of charts in parallel
+			store, err := newStateStore(stateConfig{Backend: "file"}, dir, "", &FakeRunner{})
+			if err != nil {
+				errs <- err
+				return
+			}
+			errs <- store.Save(StateKey{Chart: fmt.Sprintf("chart-%d", i), Environment: "dev"}, DeployState{Hash: fmt.Sprint(i)})
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store, err := newStateStore(stateConfig{Backend: "file"}, dir, "", &FakeRunner{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 20; i++ {
+		state, err := store.Get(StateKey{Chart: fmt.Sprintf("chart-%d", i), Environment: "dev"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state.Hash != fmt.Sprint(i) {
+			t.Errorf("expected the state of chart-%d to be saved, got %+v", i, state)
+		}
+	}
+}
+
+func TestKubernetesStateStoreCompressesManifest(t *testing.T) {
+	// a manifest far above the 256KiB limit of the last-applied annotation
+	manifest := strings.Repeat(testManifest, 20000)
+	key := StateKey{Project: "shop", Chart: "web", Environment: "dev"}
+
+	for _, kind := range []string{"secret", "configmap"} {
+		t.Run(kind, func(t *testing.T) {
+			runner := &FakeRunner{}
+
+			store, err := newStateStore(stateConfig{Backend: kind}, "", "", runner)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := store.Save(key, DeployState{Hash: "abc", Manifest: manifest}); err != nil {
+				t.Fatal(err)
+			}
+
+			call := runner.Calls()[0]
+			if expected := []string{"apply", "--server-side", "--force-conflicts", "--field-manager", "kip", "-f", "-"}; !reflect.DeepEqual(call.Args, expected) {
+				t.Errorf("expected kubectl %v, got %v", expected, call.Args)
+			}
+
+			var resource map[string]interface{}
+			if err := json.Unmarshal([]byte(call.Stdin), &resource); err != nil {
+				t.Fatal(err)
+			}
+
+			field := "data"
+			if kind == "secret" {
+				field = "stringData"
+			}
+
+			data := map[string]string{}
+			for name, value := range resource[field].(map[string]interface{}) {
+				data[name] = value.(string)
+			}
+
+			if _, ok := data["manifest"]; ok {
+				t.Error("expected the manifest to be saved compressed only")
+			}
+			if len(data[compressedManifestKey]) >= len(manifest)/10 {
+				t.Errorf("expected the manifest to be compressed, got %d bytes", len(data[compressedManifestKey]))
+			}
+
+			// kubectl returns the data of secrets base64 encoded
+			if kind == "secret" {
+				for name, value := range data {
+					data[name] = base64.StdEncoding.EncodeToString([]byte(value))
+				}
+			}
+
+			response, _ := json.Marshal(map[string]interface{}{"data": data})
+			runner.On("kubectl get", string(response), nil)
+
+			state, err := store.Get(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if state.Hash != "abc" || state.Manifest != manifest {
+				t.Errorf("expected the saved state to be read back, got hash %s and %d bytes of manifest", state.Hash, len(state.Manifest))
+			}
+		})
+	}
+}
+
+func TestStateStoresRedactSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kip-state-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	manifest := testManifest + "---\napiVersion: v1\nkind: Secret\nmetadata:\n  name: web\nstringData:\n  password: hunter2\n"
+	key := StateKey{Project: "shop", Chart: "web", Environment: "dev"}
+
+	fileStore, err := newStateStore(stateConfig{Backend: "file"}, dir, "", &FakeRunner{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fileStore.Save(key, DeployState{Hash: "abc", Manifest: manifest}); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, ".kip", "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "hunter2") || !strings.Contains(string(content), "password: sha256:") {
+		t.Errorf("expected the secret to be redacted in the state file, got %s", content)
+	}
+
+	runner := &FakeRunner{}
+	kubernetesStore, err := newStateStore(stateConfig{Backend: "configmap"}, "", "", runner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kubernetesStore.Save(key, DeployState{Hash: "abc", Manifest: manifest}); err != nil {
+		t.Fatal(err)
+	}
+
+	var resource struct {
+		Data map[string]string `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(runner.Calls()[0].Stdin), &resource); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := decompressManifest(resource.Data[compressedManifestKey])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(saved, "hunter2") || !strings.Contains(saved, "password: sha256:") {
+		t.Errorf("expected the secret to be redacted in the config map, got\n%s", saved)
+	}
+}